@@ -0,0 +1,3 @@
+ALTER TABLE events
+  DROP COLUMN IF EXISTS props,
+  DROP COLUMN IF EXISTS event_name;
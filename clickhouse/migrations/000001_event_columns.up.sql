@@ -0,0 +1,3 @@
+ALTER TABLE events
+  ADD COLUMN IF NOT EXISTS event_name String DEFAULT 'pageview',
+  ADD COLUMN IF NOT EXISTS props Map(String, String);
@@ -0,0 +1,2 @@
+ALTER TABLE events
+  ADD COLUMN IF NOT EXISTS hostname String DEFAULT '';
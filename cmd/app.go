@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/ThEditor/clutter-studio/internal/api"
+	"github.com/ThEditor/clutter-studio/internal/bots"
 	"github.com/ThEditor/clutter-studio/internal/config"
+	"github.com/ThEditor/clutter-studio/internal/geoip"
 	"github.com/ThEditor/clutter-studio/internal/mailer"
+	"github.com/ThEditor/clutter-studio/internal/referrer"
 	"github.com/ThEditor/clutter-studio/internal/repository"
 	"github.com/ThEditor/clutter-studio/internal/storage"
 )
@@ -28,6 +33,27 @@ func main() {
 	}
 	defer chstore.Close()
 
+	if cfg.GEOIP_DATABASE != "" {
+		geo, err := geoip.Open(cfg.GEOIP_DATABASE)
+		if err != nil {
+			panic(err)
+		}
+		go geo.Watch(ctx, time.Minute)
+		chstore.SetGeoIP(geo)
+	}
+
+	if cfg.REFERRER_SOURCES != "" {
+		if err := referrer.LoadFile(cfg.REFERRER_SOURCES); err != nil {
+			panic(err)
+		}
+	}
+
+	if cfg.BOT_IP_RANGES != "" {
+		if err := bots.LoadFile(cfg.BOT_IP_RANGES); err != nil {
+			panic(err)
+		}
+	}
+
 	mailer, err := mailer.NewMailer(mailer.MailerConfig{
 		Host:     cfg.SMTP_HOST,
 		Port:     cfg.SMTP_PORT,
@@ -40,5 +66,5 @@ func main() {
 	}
 	defer mailer.Close()
 
-	api.Start(ctx, cfg.BIND_ADDRESS, cfg.PORT, repo, chstore, mailer)
+	api.Start(ctx, cfg.BIND_ADDRESS, cfg.PORT, pgstore.Db, repo, chstore, mailer)
 }
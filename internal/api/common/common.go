@@ -3,6 +3,8 @@ package common
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -15,11 +17,13 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Server struct {
 	Ctx        context.Context
+	DB         *pgxpool.Pool
 	Repo       *repository.Queries
 	ClickHouse *storage.ClickHouseStorage
 	Mailer     *mailer.Mailer
@@ -55,6 +59,65 @@ func SendVerificationMail(mailer mailer.Mailer, to string, code string) error {
 	return mailer.Send([]string{to}, "Clutter Verification Code", "Your verification code for Clutter Analytics is: "+code)
 }
 
+// Password reset
+const PasswordResetExpiration = time.Hour
+
+// HashToken returns the hex encoded SHA-256 digest of a token, which is what
+// gets stored in the database instead of the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func SendPasswordResetMail(mailer mailer.Mailer, to string, token string) error {
+	cfg := config.Get()
+	link := cfg.FRONTEND_URL + "/reset-password?token=" + token
+	return mailer.Send([]string{to}, "Clutter Password Reset", "Use the following link to reset your Clutter Analytics password: "+link+"\r\n\r\nThe link expires in one hour. If you did not request a password reset, you can ignore this email.")
+}
+
+// API keys
+const APIKeyPrefix = "clt_"
+
+const (
+	APIKeyScopeReadOnly   = "read-only"
+	APIKeyScopeSitesWrite = "sites:write"
+)
+
+// GenerateAPIKey returns a new API key along with the short prefix that is
+// kept in plain text so users can tell their keys apart.
+func GenerateAPIKey() (string, string) {
+	key := APIKeyPrefix + GenerateRandomCode(40)
+	return key, key[:len(APIKeyPrefix)+8]
+}
+
+// Invitations
+const InvitationExpiration = 7 * 24 * time.Hour
+
+func SendInvitationMail(mailer mailer.Mailer, to string, inviter string, target string, token string) error {
+	cfg := config.Get()
+	link := cfg.FRONTEND_URL + "/invitations?token=" + token
+	return mailer.Send([]string{to}, "Clutter Invitation", inviter+" invited you to "+target+" on Clutter Analytics. Use the following link to accept or decline the invitation: "+link+"\r\n\r\nThe invitation expires in 7 days.")
+}
+
+// Organization roles
+const (
+	RoleViewer = "viewer"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// HasRole reports whether role grants at least the permissions of required.
+func HasRole(role string, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
 // Validator
 func IsYYYYMMDDDate(fl validator.FieldLevel) bool {
 	YYYYMMDDDateRegexString := "^(\\d{4})-(0[1-9]|1[0-2])-(0[1-9]|[12]\\d|3[01])$"
@@ -65,22 +128,25 @@ func IsYYYYMMDDDate(fl validator.FieldLevel) bool {
 var Validate = validator.New()
 var _ = Validate.RegisterValidation("YYYYMMDDdate", IsYYYYMMDDDate)
 
-const expirationDuration = 24 * time.Hour
+const AccessTokenExpiration = 15 * time.Minute
+const RefreshTokenExpiration = 30 * 24 * time.Hour
 
 // JWT
 
 type Claims struct {
+	SessionID     uuid.UUID `json:"session_id"`
 	UserID        uuid.UUID `json:"user_id"`
 	Email         string    `json:"email"`
 	EmailVerified bool      `json:"email_verified"`
 	jwt.RegisteredClaims
 }
 
-func CreateJWT(userID uuid.UUID, email string, verified bool) (string, error) {
+func CreateJWT(sessionID uuid.UUID, userID uuid.UUID, email string, verified bool) (string, error) {
 	cfg := config.Get()
-	expirationTime := time.Now().Add(expirationDuration)
+	expirationTime := time.Now().Add(AccessTokenExpiration)
 
 	claims := &Claims{
+		SessionID:     sessionID,
 		UserID:        userID,
 		Email:         email,
 		EmailVerified: verified,
@@ -130,7 +196,7 @@ func AttachJWTCookie(w http.ResponseWriter, jwt string) {
 		Name:     "accessToken",
 		Value:    jwt,
 		Path:     "/",
-		MaxAge:   int(expirationDuration.Seconds()),
+		MaxAge:   int(AccessTokenExpiration.Seconds()),
 		HttpOnly: true,
 		Secure:   !cfg.DEV_MODE,
 		SameSite: http.SameSiteStrictMode,
@@ -154,3 +220,43 @@ func DetachJWTCookie(w http.ResponseWriter) {
 
 	http.SetCookie(w, &cookie)
 }
+
+// Refresh tokens
+
+// GenerateRefreshToken returns a new opaque refresh token, only its hash is
+// persisted with the session.
+func GenerateRefreshToken() string {
+	return GenerateRandomCode(48)
+}
+
+func AttachRefreshCookie(w http.ResponseWriter, token string) {
+	cfg := config.Get()
+
+	cookie := http.Cookie{
+		Name:     "refreshToken",
+		Value:    token,
+		Path:     "/auth",
+		MaxAge:   int(RefreshTokenExpiration.Seconds()),
+		HttpOnly: true,
+		Secure:   !cfg.DEV_MODE,
+		SameSite: http.SameSiteStrictMode,
+	}
+
+	http.SetCookie(w, &cookie)
+}
+
+func DetachRefreshCookie(w http.ResponseWriter) {
+	cfg := config.Get()
+
+	cookie := http.Cookie{
+		Name:     "refreshToken",
+		Value:    "",
+		Path:     "/auth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !cfg.DEV_MODE,
+		SameSite: http.SameSiteStrictMode,
+	}
+
+	http.SetCookie(w, &cookie)
+}
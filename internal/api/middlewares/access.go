@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const SiteKey contextKey = "site"
+const OrganizationKey contextKey = "organization"
+const RoleKey contextKey = "role"
+
+// SiteAccess loads the site named by the {id} URL parameter into the request
+// context, rejecting users that don't hold at least the required role on it.
+func SiteAccess(s *common.Server, required string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			siteId, err := uuid.Parse(chi.URLParam(r, "id"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			site, err := s.Repo.FindSiteByID(s.Ctx, siteId)
+			if err != nil {
+				http.Error(w, "Couldn't find site", http.StatusNotFound)
+				return
+			}
+
+			role, err := s.Repo.FindUserSiteRole(s.Ctx, repository.FindUserSiteRoleParams{
+				SiteID: site.ID,
+				UserID: claims.UserID,
+			})
+			if err != nil || !common.HasRole(role, required) {
+				http.Error(w, "You do not have access to this site", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), SiteKey, &site)
+			ctx = context.WithValue(ctx, RoleKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// OrganizationAccess loads the organization named by the {id} URL parameter
+// into the request context, rejecting users that don't hold at least the
+// required role in it.
+func OrganizationAccess(s *common.Server, required string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			orgId, err := uuid.Parse(chi.URLParam(r, "id"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			org, err := s.Repo.FindOrganizationByID(s.Ctx, orgId)
+			if err != nil {
+				http.Error(w, "Couldn't find organization", http.StatusNotFound)
+				return
+			}
+
+			role, err := s.Repo.FindOrganizationMemberRole(s.Ctx, repository.FindOrganizationMemberRoleParams{
+				OrganizationID: org.ID,
+				UserID:         claims.UserID,
+			})
+			if err != nil || !common.HasRole(role, required) {
+				http.Error(w, "You do not have access to this organization", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), OrganizationKey, &org)
+			ctx = context.WithValue(ctx, RoleKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -2,17 +2,21 @@ package middlewares
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/config"
 )
 
 type contextKey string
 
 const ClaimsKey contextKey = "claims"
+const APIKeyKey contextKey = "api_key"
 
-func baseAuthMiddleware(next http.Handler, requireEmailVerification bool) http.Handler {
+func baseAuthMiddleware(s *common.Server, next http.Handler, requireEmailVerification bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("accessToken")
 
@@ -34,6 +38,12 @@ func baseAuthMiddleware(next http.Handler, requireEmailVerification bool) http.H
 			return
 		}
 
+		session, err := s.Repo.FindActiveSessionByID(s.Ctx, claims.SessionID)
+		if err != nil || session.UserID != claims.UserID {
+			http.Error(w, "Session expired or revoked", http.StatusUnauthorized)
+			return
+		}
+
 		if requireEmailVerification && !claims.EmailVerified {
 			http.Error(w, "Email not verified", http.StatusUnauthorized)
 			return
@@ -44,10 +54,80 @@ func baseAuthMiddleware(next http.Handler, requireEmailVerification bool) http.H
 	})
 }
 
-func AuthWithoutEmailVerifiedMiddleware(next http.Handler) http.Handler {
-	return baseAuthMiddleware(next, false)
+func AuthWithoutEmailVerifiedMiddleware(s *common.Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return baseAuthMiddleware(s, next, false)
+	}
+}
+
+func AuthMiddleware(s *common.Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return baseAuthMiddleware(s, next, true)
+	}
+}
+
+// APIKeyOrAuthMiddleware accepts an API key passed as a bearer token and
+// falls back to AuthMiddleware for requests that don't carry one.
+func APIKeyOrAuthMiddleware(s *common.Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		sessionAuth := AuthMiddleware(s)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || !strings.HasPrefix(key, common.APIKeyPrefix) {
+				sessionAuth.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, err := s.Repo.FindActiveAPIKeyByHash(s.Ctx, common.HashToken(key))
+			if err != nil {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			if apiKey.Scope == common.APIKeyScopeReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "API key is read-only", http.StatusForbidden)
+				return
+			}
+
+			user, err := s.Repo.FindUserByID(s.Ctx, apiKey.UserID)
+			if err != nil {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			if !user.EmailVerified {
+				http.Error(w, "Email not verified", http.StatusUnauthorized)
+				return
+			}
+
+			s.Repo.UpdateAPIKeyLastUsed(s.Ctx, apiKey.ID)
+
+			claims := &common.Claims{
+				UserID:        user.ID,
+				Email:         user.Email,
+				EmailVerified: user.EmailVerified,
+			}
+
+			ctx := context.WithValue(r.Context(), ClaimsKey, claims)
+			ctx = context.WithValue(ctx, APIKeyKey, &apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return baseAuthMiddleware(next, true)
+// CollectorAuthMiddleware admits the Paper collector, which authenticates
+// with COLLECTOR_TOKEN as a bearer token. Without a configured token every
+// request is rejected.
+func CollectorAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := config.Get().COLLECTOR_TOKEN
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
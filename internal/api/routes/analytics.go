@@ -0,0 +1,578 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/ThEditor/clutter-studio/internal/storage"
+)
+
+type AnalyticsRequest struct {
+	From        string `json:"from" validate:"omitempty,YYYYMMDDdate"`
+	To          string `json:"to" validate:"omitempty,YYYYMMDDdate"`
+	Filters     string `json:"filters" validate:"omitempty,max=2048"`
+	Compare     string `json:"compare" validate:"omitempty,oneof=previous_period previous_year custom"`
+	CompareFrom string `json:"compare_from" validate:"required_if=Compare custom,omitempty,YYYYMMDDdate"`
+	CompareTo   string `json:"compare_to" validate:"required_if=Compare custom,omitempty,YYYYMMDDdate"`
+	Granularity string `json:"granularity" validate:"omitempty,oneof=hour day week month"`
+	Metric      string `json:"metric" validate:"omitempty,oneof=visitors pageviews visits bounce_rate"`
+}
+
+type EventPropertiesRequest struct {
+	PaginationRequest
+	Event    string `json:"event" validate:"required,max=120"`
+	Property string `json:"property" validate:"required,max=120"`
+}
+
+type RetentionRequest struct {
+	Granularity string `json:"granularity" validate:"required,oneof=day week month"`
+	Periods     int    `json:"periods" validate:"min=1,max=52"`
+}
+
+// number of periods after the first one a retention report follows by default
+const defaultRetentionPeriods = 8
+
+type FlowRequest struct {
+	Page      string `json:"page" validate:"required,startswith=/,max=2048"`
+	Direction string `json:"direction" validate:"required,oneof=next previous"`
+	Steps     int    `json:"steps" validate:"min=1,max=5"`
+	Limit     int    `json:"limit" validate:"min=1,max=20"`
+}
+
+// defaults of the number of steps a flow follows and pages kept per step
+const (
+	defaultFlowSteps = 3
+	defaultFlowLimit = 5
+)
+
+type PaginationRequest struct {
+	Limit  int `json:"limit" validate:"min=1,max=1000"`
+	Offset int `json:"offset" validate:"min=0"`
+}
+
+type BreakdownRequest struct {
+	PaginationRequest
+	Property string `json:"property" validate:"required"`
+}
+
+// number of rows returned by a breakdown when limit is omitted
+const defaultBreakdownLimit = 10
+
+// number of days covered by the analytics window when from is omitted
+const defaultAnalyticsDays = 30
+
+// longest window a single analytics request may cover
+const maxAnalyticsDays = 3 * 366
+
+// most buckets a graph may be split into
+const maxGraphPoints = 1500
+
+// TimeRange turns the inclusive from/to dates in the timezone loc into a
+// storage.TimeRange, defaulting to the defaultAnalyticsDays days ending today.
+func (req AnalyticsRequest) TimeRange(loc *time.Location) (storage.TimeRange, error) {
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if req.To != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, req.To, loc)
+		if err != nil {
+			return storage.TimeRange{}, err
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, 1-defaultAnalyticsDays)
+	if req.From != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, req.From, loc)
+		if err != nil {
+			return storage.TimeRange{}, err
+		}
+		from = parsed
+	}
+
+	return newTimeRange(from, to)
+}
+
+// ComparisonRange returns the window the request's range is compared
+// against, or nil when no comparison was asked for.
+func (req AnalyticsRequest) ComparisonRange(tr storage.TimeRange, loc *time.Location) (*storage.TimeRange, error) {
+	var compared storage.TimeRange
+	switch req.Compare {
+	case "":
+		return nil, nil
+	case "previous_period":
+		// step back in calendar days, which differ from 24 hours across daylight
+		// saving time changes
+		from, to := tr.From.In(loc), tr.To.In(loc)
+		days := int(time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).
+			Sub(time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+		compared = storage.TimeRange{From: from.AddDate(0, 0, -days), To: from}
+	case "previous_year":
+		from, to := tr.From.In(loc), tr.To.In(loc)
+		lastYear := from.AddDate(-1, 0, 0)
+		// Feb 29 starts from Feb 28 instead of rolling over to Mar 1
+		if lastYear.Day() != from.Day() {
+			lastYear = lastYear.AddDate(0, 0, -lastYear.Day())
+		}
+		compared = storage.TimeRange{From: lastYear, To: to.AddDate(-1, 0, 0)}
+	case "custom":
+		from, err := time.ParseInLocation(time.DateOnly, req.CompareFrom, loc)
+		if err != nil {
+			return nil, err
+		}
+		to, err := time.ParseInLocation(time.DateOnly, req.CompareTo, loc)
+		if err != nil {
+			return nil, err
+		}
+		compared, err = newTimeRange(from, to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &compared, nil
+}
+
+// newTimeRange builds the half-open range covering the inclusive from/to
+// dates.
+func newTimeRange(from time.Time, to time.Time) (storage.TimeRange, error) {
+	if from.After(to) {
+		return storage.TimeRange{}, errors.New("from must not be after to")
+	}
+
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		return storage.TimeRange{}, errors.New("date range is too long")
+	}
+
+	return storage.TimeRange{From: from, To: to.AddDate(0, 0, 1)}, nil
+}
+
+type MetricComparison struct {
+	Value         int      `json:"value"`
+	PercentChange *float64 `json:"percent_change"`
+}
+
+// VisitorGraphPoint is a point of the visitor graph, overlaid with the point
+// at the same position of the comparison range when there is one.
+type VisitorGraphPoint struct {
+	storage.GraphPoint
+	ComparisonTime  *time.Time `json:"comparison_time,omitempty"`
+	ComparisonValue *float64   `json:"comparison_value,omitempty"`
+}
+
+type AnalyticsComparison struct {
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	PageViews      MetricComparison `json:"page_views"`
+	UniqueVisitors MetricComparison `json:"unique_visitors"`
+}
+
+type AnalyticsResponse struct {
+	storage.SessionStats
+	TopPages       []storage.PageStats      `json:"top_pages"`
+	DeviceStats    []storage.DeviceStats    `json:"device_stats"`
+	PageViews      int                      `json:"page_views"`
+	TopReferrers   []storage.ReferrerStats  `json:"top_referrers"`
+	UniqueVisitors int                      `json:"unique_visitors"`
+	VisitorGraph   []VisitorGraphPoint      `json:"visitor_graph"`
+	GraphMetric    storage.GraphMetric      `json:"graph_metric"`
+	Granularity    storage.Granularity      `json:"granularity"`
+	Goals          []storage.GoalConversion `json:"goals"`
+	CustomEvents   []storage.EventStats     `json:"custom_events"`
+	Comparison     *AnalyticsComparison     `json:"comparison,omitempty"`
+}
+
+// analyticsQuery is a parsed analytics request.
+type analyticsQuery struct {
+	Query       storage.Query
+	Compare     *storage.Query
+	Granularity storage.Granularity
+	Metric      storage.GraphMetric
+}
+
+// parseAnalyticsRequest validates the analytics query parameters of r and
+// turns them into queries over the site's events.
+func parseAnalyticsRequest(r *http.Request, site *repository.Site, settings repository.Sitesetting, domains []string) (*analyticsQuery, error) {
+	var req AnalyticsRequest
+	req.From = r.URL.Query().Get("from")
+	req.To = r.URL.Query().Get("to")
+	req.Filters = r.URL.Query().Get("filters")
+	req.Compare = r.URL.Query().Get("compare")
+	req.CompareFrom = r.URL.Query().Get("compare_from")
+	req.CompareTo = r.URL.Query().Get("compare_to")
+	req.Granularity = r.URL.Query().Get("granularity")
+	req.Metric = r.URL.Query().Get("metric")
+
+	if err := common.Validate.Struct(req); err != nil {
+		return nil, err
+	}
+
+	query, err := siteQuery(site, settings, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	timeRange, err := req.TimeRange(query.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := storage.ParseFilters(req.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	query.Range = timeRange
+	query.Filters = filters
+	aq := &analyticsQuery{
+		Query:       query,
+		Granularity: storage.GranularityDay,
+		Metric:      storage.MetricVisitors,
+	}
+
+	if req.Granularity != "" {
+		aq.Granularity = storage.Granularity(req.Granularity)
+	}
+
+	if req.Metric != "" {
+		aq.Metric = storage.GraphMetric(req.Metric)
+	}
+
+	if len(storage.GraphBuckets(timeRange, aq.Granularity, query.Location)) > maxGraphPoints {
+		return nil, errors.New("date range is too long for this granularity")
+	}
+
+	comparisonRange, err := req.ComparisonRange(timeRange, query.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	if comparisonRange != nil {
+		if len(storage.GraphBuckets(*comparisonRange, aq.Granularity, query.Location)) > maxGraphPoints {
+			return nil, errors.New("comparison range is too long for this granularity")
+		}
+
+		compare := aq.Query
+		compare.Range = *comparisonRange
+		aq.Compare = &compare
+	}
+
+	return aq, nil
+}
+
+// analyticsQueryFromRequest parses the analytics request for a site with its
+// settings applied, writing the error response itself when that fails.
+func analyticsQueryFromRequest(s *common.Server, w http.ResponseWriter, r *http.Request, site *repository.Site) (*analyticsQuery, bool) {
+	settings, err := loadSiteSettings(s, site.ID)
+	if err != nil {
+		http.Error(w, "Couldn't load site settings", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	domains, err := loadSiteDomains(s, site)
+	if err != nil {
+		http.Error(w, "Couldn't load site domains", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	aq, err := parseAnalyticsRequest(r, site, settings, domains)
+	if err != nil {
+		http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	aq.Query, err = s.ClickHouse.ResolveFilters(aq.Query)
+	if err != nil {
+		resolveFiltersError(w, err)
+		return nil, false
+	}
+
+	if aq.Compare != nil {
+		compare, err := s.ClickHouse.ResolveFilters(*aq.Compare)
+		if err != nil {
+			resolveFiltersError(w, err)
+			return nil, false
+		}
+		aq.Compare = &compare
+	}
+
+	return aq, true
+}
+
+// resolveFiltersError reports a failure to resolve the filters of an
+// analytics request.
+func resolveFiltersError(w http.ResponseWriter, err error) {
+	if errors.Is(err, storage.ErrTooManyValues) {
+		http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+}
+
+// parsePagination validates the limit and offset parameters of a paginated
+// analytics request.
+func parsePagination(r *http.Request) (*PaginationRequest, error) {
+	req := PaginationRequest{Limit: defaultBreakdownLimit}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, errors.New("limit must be a number")
+		}
+		req.Limit = parsed
+	}
+
+	if offset := r.URL.Query().Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil {
+			return nil, errors.New("offset must be a number")
+		}
+		req.Offset = parsed
+	}
+
+	if err := common.Validate.Struct(req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// parseBreakdownRequest validates the property and pagination parameters of
+// a breakdown request.
+func parseBreakdownRequest(r *http.Request) (*BreakdownRequest, error) {
+	pagination, err := parsePagination(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := BreakdownRequest{
+		PaginationRequest: *pagination,
+		Property:          r.URL.Query().Get("property"),
+	}
+
+	if err := common.Validate.Struct(req); err != nil {
+		return nil, err
+	}
+
+	if !storage.IsBreakdownDimension(req.Property) {
+		return nil, fmt.Errorf("unknown breakdown property %q", req.Property)
+	}
+
+	return &req, nil
+}
+
+// parseEventPropertiesRequest validates the event, property and pagination
+// parameters of an event properties request.
+func parseEventPropertiesRequest(r *http.Request) (*EventPropertiesRequest, error) {
+	pagination, err := parsePagination(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := EventPropertiesRequest{
+		PaginationRequest: *pagination,
+		Event:             r.URL.Query().Get("event"),
+		Property:          r.URL.Query().Get("property"),
+	}
+
+	if err := common.Validate.Struct(req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// parseRetentionRequest validates the cohort granularity and number of
+// periods of a retention request, defaulting to weekly cohorts.
+func parseRetentionRequest(r *http.Request) (*RetentionRequest, error) {
+	req := RetentionRequest{
+		Granularity: r.URL.Query().Get("granularity"),
+		Periods:     defaultRetentionPeriods,
+	}
+
+	if req.Granularity == "" {
+		req.Granularity = string(storage.GranularityWeek)
+	}
+
+	if periods := r.URL.Query().Get("periods"); periods != "" {
+		parsed, err := strconv.Atoi(periods)
+		if err != nil {
+			return nil, errors.New("periods must be a number")
+		}
+		req.Periods = parsed
+	}
+
+	if err := common.Validate.Struct(req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// parseFlowRequest validates the page, direction, steps and limit of a flow
+// request.
+func parseFlowRequest(r *http.Request) (*FlowRequest, error) {
+	req := FlowRequest{
+		Page:      r.URL.Query().Get("page"),
+		Direction: r.URL.Query().Get("direction"),
+		Steps:     defaultFlowSteps,
+		Limit:     defaultFlowLimit,
+	}
+
+	if req.Direction == "" {
+		req.Direction = string(storage.FlowNext)
+	}
+
+	if steps := r.URL.Query().Get("steps"); steps != "" {
+		parsed, err := strconv.Atoi(steps)
+		if err != nil {
+			return nil, errors.New("steps must be a number")
+		}
+		req.Steps = parsed
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, errors.New("limit must be a number")
+		}
+		req.Limit = parsed
+	}
+
+	if err := common.Validate.Struct(req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// percentChange returns the change from previous to current in percent, or
+// nil when there is nothing to compare against.
+func percentChange(current int, previous int) *float64 {
+	if previous == 0 {
+		return nil
+	}
+
+	change := math.Round(float64(current-previous)/float64(previous)*10000) / 100
+	return &change
+}
+
+// siteAnalytics gathers every metric shown on the dashboard of a site.
+func siteAnalytics(s *common.Server, aq *analyticsQuery) (*AnalyticsResponse, error) {
+	q := aq.Query
+
+	topPages, err := s.ClickHouse.GetTopPages(q, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceStats, err := s.ClickHouse.GetDeviceStats(q)
+	if err != nil {
+		return nil, err
+	}
+
+	pageViews, err := s.ClickHouse.GetPageViews(q)
+	if err != nil {
+		return nil, err
+	}
+
+	topReferrers, err := s.ClickHouse.GetTopReferrers(q, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	uniqueVisitors, err := s.ClickHouse.GetUniqueVisitors(q)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionStats, err := s.ClickHouse.GetSessionStats(q)
+	if err != nil {
+		return nil, err
+	}
+
+	visitorGraph, err := s.ClickHouse.GetGraph(q, aq.Granularity, aq.Metric)
+	if err != nil {
+		return nil, err
+	}
+
+	goals, err := s.Repo.ListGoalsBySiteID(s.Ctx, q.SiteID)
+	if err != nil {
+		return nil, err
+	}
+
+	conversions, err := s.ClickHouse.GetGoalConversions(q, storageGoals(goals))
+	if err != nil {
+		return nil, err
+	}
+
+	customEvents, err := s.ClickHouse.GetCustomEvents(q, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &AnalyticsResponse{
+		SessionStats:   sessionStats,
+		TopPages:       topPages,
+		DeviceStats:    deviceStats,
+		PageViews:      pageViews,
+		TopReferrers:   topReferrers,
+		UniqueVisitors: uniqueVisitors,
+		VisitorGraph:   make([]VisitorGraphPoint, 0, len(visitorGraph)),
+		GraphMetric:    aq.Metric,
+		Granularity:    aq.Granularity,
+		Goals:          conversions,
+		CustomEvents:   customEvents,
+	}
+
+	for _, point := range visitorGraph {
+		res.VisitorGraph = append(res.VisitorGraph, VisitorGraphPoint{GraphPoint: point})
+	}
+
+	if aq.Compare == nil {
+		return res, nil
+	}
+
+	comparePageViews, err := s.ClickHouse.GetPageViews(*aq.Compare)
+	if err != nil {
+		return nil, err
+	}
+
+	compareUniqueVisitors, err := s.ClickHouse.GetUniqueVisitors(*aq.Compare)
+	if err != nil {
+		return nil, err
+	}
+
+	compareGraph, err := s.ClickHouse.GetGraph(*aq.Compare, aq.Granularity, aq.Metric)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Comparison = &AnalyticsComparison{
+		From: aq.Compare.Range.From,
+		To:   aq.Compare.Range.To,
+		PageViews: MetricComparison{
+			Value:         comparePageViews,
+			PercentChange: percentChange(pageViews, comparePageViews),
+		},
+		UniqueVisitors: MetricComparison{
+			Value:         compareUniqueVisitors,
+			PercentChange: percentChange(uniqueVisitors, compareUniqueVisitors),
+		},
+	}
+
+	for i := range res.VisitorGraph {
+		if i >= len(compareGraph) {
+			break
+		}
+		res.VisitorGraph[i].ComparisonTime = &compareGraph[i].Time
+		res.VisitorGraph[i].ComparisonValue = &compareGraph[i].Value
+	}
+
+	return res, nil
+}
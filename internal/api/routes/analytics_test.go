@@ -0,0 +1,250 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/storage"
+)
+
+func date(value string) time.Time {
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestTimeRange(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		req      AnalyticsRequest
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "to is inclusive",
+			req:      AnalyticsRequest{From: "2024-03-01", To: "2024-03-07"},
+			wantFrom: date("2024-03-01"),
+			wantTo:   date("2024-03-08"),
+		},
+		{
+			name:     "single day",
+			req:      AnalyticsRequest{From: "2024-03-01", To: "2024-03-01"},
+			wantFrom: date("2024-03-01"),
+			wantTo:   date("2024-03-02"),
+		},
+		{
+			name:     "across a month end",
+			req:      AnalyticsRequest{From: "2024-02-28", To: "2024-02-29"},
+			wantFrom: date("2024-02-28"),
+			wantTo:   date("2024-03-01"),
+		},
+		{
+			name:     "defaults to the last 30 days",
+			req:      AnalyticsRequest{},
+			wantFrom: today.AddDate(0, 0, -29),
+			wantTo:   today.AddDate(0, 0, 1),
+		},
+		{
+			name:     "from defaults to 30 days before to",
+			req:      AnalyticsRequest{To: "2024-03-30"},
+			wantFrom: date("2024-03-01"),
+			wantTo:   date("2024-03-31"),
+		},
+		{
+			name:     "to defaults to today",
+			req:      AnalyticsRequest{From: today.AddDate(0, 0, -6).Format(time.DateOnly)},
+			wantFrom: today.AddDate(0, 0, -6),
+			wantTo:   today.AddDate(0, 0, 1),
+		},
+		{
+			name:     "longest range",
+			req:      AnalyticsRequest{From: "2021-01-01", To: date("2021-01-01").AddDate(0, 0, maxAnalyticsDays-1).Format(time.DateOnly)},
+			wantFrom: date("2021-01-01"),
+			wantTo:   date("2021-01-01").AddDate(0, 0, maxAnalyticsDays),
+		},
+		{name: "range too long", req: AnalyticsRequest{From: "2021-01-01", To: date("2021-01-01").AddDate(0, 0, maxAnalyticsDays).Format(time.DateOnly)}, wantErr: true},
+		{name: "from after to", req: AnalyticsRequest{From: "2024-03-02", To: "2024-03-01"}, wantErr: true},
+		{name: "from after default to", req: AnalyticsRequest{From: today.AddDate(0, 0, 1).Format(time.DateOnly)}, wantErr: true},
+		{name: "invalid from", req: AnalyticsRequest{From: "2024-02-30", To: "2024-03-01"}, wantErr: true},
+		{name: "invalid to", req: AnalyticsRequest{From: "2024-03-01", To: "03/01/2024"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.TimeRange(time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TimeRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.From.Equal(tt.wantFrom) || !got.To.Equal(tt.wantTo) {
+				t.Errorf("TimeRange() = [%v, %v), want [%v, %v)", got.From, got.To, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestComparisonRange(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inNewYork := func(value string) time.Time {
+		parsed, err := time.ParseInLocation(time.DateOnly, value, newYork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	week := storageRange("2024-03-11", "2024-03-18")
+
+	tests := []struct {
+		name     string
+		req      AnalyticsRequest
+		tr       [2]time.Time
+		loc      *time.Location
+		wantNil  bool
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{name: "no comparison", req: AnalyticsRequest{}, tr: week, wantNil: true},
+		{
+			name:     "previous period",
+			req:      AnalyticsRequest{Compare: "previous_period"},
+			tr:       week,
+			wantFrom: date("2024-03-04"),
+			wantTo:   date("2024-03-11"),
+		},
+		{
+			name:     "previous period across a month end",
+			req:      AnalyticsRequest{Compare: "previous_period"},
+			tr:       storageRange("2024-03-01", "2024-04-01"),
+			wantFrom: date("2024-01-30"),
+			wantTo:   date("2024-03-01"),
+		},
+		{
+			name:     "previous period across daylight saving time",
+			req:      AnalyticsRequest{Compare: "previous_period"},
+			tr:       [2]time.Time{inNewYork("2024-11-04"), inNewYork("2024-11-11")},
+			loc:      newYork,
+			wantFrom: inNewYork("2024-10-28"),
+			wantTo:   inNewYork("2024-11-04"),
+		},
+		{
+			name:     "previous period across the spring change",
+			req:      AnalyticsRequest{Compare: "previous_period"},
+			tr:       [2]time.Time{inNewYork("2024-03-10"), inNewYork("2024-03-17")},
+			loc:      newYork,
+			wantFrom: inNewYork("2024-03-03"),
+			wantTo:   inNewYork("2024-03-10"),
+		},
+		{
+			name:     "previous year",
+			req:      AnalyticsRequest{Compare: "previous_year"},
+			tr:       week,
+			wantFrom: date("2023-03-11"),
+			wantTo:   date("2023-03-18"),
+		},
+		{
+			name:     "previous year from Feb 29",
+			req:      AnalyticsRequest{Compare: "previous_year"},
+			tr:       storageRange("2024-02-29", "2024-03-01"),
+			wantFrom: date("2023-02-28"),
+			wantTo:   date("2023-03-01"),
+		},
+		{
+			name:     "previous year up to Feb 29",
+			req:      AnalyticsRequest{Compare: "previous_year"},
+			tr:       storageRange("2024-02-01", "2024-02-29"),
+			wantFrom: date("2023-02-01"),
+			wantTo:   date("2023-03-01"),
+		},
+		{
+			name:     "previous year in the site timezone",
+			req:      AnalyticsRequest{Compare: "previous_year"},
+			tr:       [2]time.Time{inNewYork("2024-02-29"), inNewYork("2024-03-07")},
+			loc:      newYork,
+			wantFrom: inNewYork("2023-02-28"),
+			wantTo:   inNewYork("2023-03-07"),
+		},
+		{
+			name:     "custom",
+			req:      AnalyticsRequest{Compare: "custom", CompareFrom: "2023-12-01", CompareTo: "2023-12-31"},
+			tr:       week,
+			wantFrom: date("2023-12-01"),
+			wantTo:   date("2024-01-01"),
+		},
+		{name: "custom from after to", req: AnalyticsRequest{Compare: "custom", CompareFrom: "2023-12-31", CompareTo: "2023-12-01"}, tr: week, wantErr: true},
+		{name: "custom range too long", req: AnalyticsRequest{Compare: "custom", CompareFrom: "2019-01-01", CompareTo: "2023-12-31"}, tr: week, wantErr: true},
+		{name: "custom without from", req: AnalyticsRequest{Compare: "custom", CompareTo: "2023-12-31"}, tr: week, wantErr: true},
+		{name: "custom with invalid to", req: AnalyticsRequest{Compare: "custom", CompareFrom: "2023-12-01", CompareTo: "2023-13-01"}, tr: week, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			got, err := tt.req.ComparisonRange(storage.TimeRange{From: tt.tr[0], To: tt.tr[1]}, loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ComparisonRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.wantErr:
+			case tt.wantNil:
+				if got != nil {
+					t.Errorf("ComparisonRange() = %+v, want nil", got)
+				}
+			case got == nil:
+				t.Errorf("ComparisonRange() = nil, want [%v, %v)", tt.wantFrom, tt.wantTo)
+			case !got.From.Equal(tt.wantFrom) || !got.To.Equal(tt.wantTo):
+				t.Errorf("ComparisonRange() = [%v, %v), want [%v, %v)", got.From, got.To, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+// storageRange returns the half-open range between two dates.
+func storageRange(from string, to string) [2]time.Time {
+	return [2]time.Time{date(from), date(to)}
+}
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		current  int
+		previous int
+		want     *float64
+	}{
+		{current: 150, previous: 100, want: ptr(50)},
+		{current: 50, previous: 100, want: ptr(-50)},
+		{current: 100, previous: 100, want: ptr(0)},
+		{current: 0, previous: 100, want: ptr(-100)},
+		{current: 3, previous: 1, want: ptr(200)},
+		{current: 1, previous: 3, want: ptr(-66.67)},
+		{current: 10, previous: 0, want: nil},
+		{current: 0, previous: 0, want: nil},
+	}
+
+	for _, tt := range tests {
+		got := percentChange(tt.current, tt.previous)
+		switch {
+		case tt.want == nil && got != nil:
+			t.Errorf("percentChange(%d, %d) = %v, want nil", tt.current, tt.previous, *got)
+		case tt.want != nil && (got == nil || *got != *tt.want):
+			t.Errorf("percentChange(%d, %d) = %v, want %v", tt.current, tt.previous, got, *tt.want)
+		}
+	}
+}
+
+func ptr(value float64) *float64 {
+	return &value
+}
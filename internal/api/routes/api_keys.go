@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type CreateAPIKeyRequest struct {
+	Name  string `json:"name" validate:"required,max=255"`
+	Scope string `json:"scope" validate:"required,oneof=read-only sites:write"`
+}
+
+type RenameAPIKeyRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	Key        string     `json:"key,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPIKeyResponse(apiKey repository.Apikey) APIKeyResponse {
+	res := APIKeyResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scope:     apiKey.Scope,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if apiKey.LastUsedAt.Valid {
+		res.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	return res
+}
+
+func APIKeysRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		apiKeys, err := s.Repo.ListActiveAPIKeysByUserID(s.Ctx, claims.UserID)
+		if err != nil {
+			http.Error(w, "Couldn't fetch list of API keys", http.StatusInternalServerError)
+			return
+		}
+
+		res := make([]APIKeyResponse, 0, len(apiKeys))
+		for _, apiKey := range apiKeys {
+			res = append(res, newAPIKeyResponse(apiKey))
+		}
+
+		json.NewEncoder(w).Encode(res)
+	})
+
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := common.Validate.Struct(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		key, prefix := common.GenerateAPIKey()
+
+		apiKey, err := s.Repo.CreateAPIKey(s.Ctx, repository.CreateAPIKeyParams{
+			UserID:  claims.UserID,
+			Name:    req.Name,
+			Prefix:  prefix,
+			KeyHash: common.HashToken(key),
+			Scope:   req.Scope,
+		})
+
+		if err != nil {
+			http.Error(w, "Couldn't create API key", http.StatusInternalServerError)
+			return
+		}
+
+		// the key itself is only ever shown in this response
+		res := newAPIKeyResponse(apiKey)
+		res.Key = key
+
+		json.NewEncoder(w).Encode(res)
+	})
+
+	r.Put("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		keyId, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid UUID", http.StatusBadRequest)
+			return
+		}
+
+		var req RenameAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := common.Validate.Struct(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		apiKey, err := s.Repo.RenameAPIKey(s.Ctx, repository.RenameAPIKeyParams{
+			Name:   req.Name,
+			ID:     keyId,
+			UserID: claims.UserID,
+		})
+
+		if err != nil {
+			http.Error(w, "Couldn't find API key", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(newAPIKeyResponse(apiKey))
+	})
+
+	r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		keyId, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid UUID", http.StatusBadRequest)
+			return
+		}
+
+		revoked, err := s.Repo.RevokeAPIKey(s.Ctx, repository.RevokeAPIKeyParams{
+			ID:     keyId,
+			UserID: claims.UserID,
+		})
+
+		if err != nil {
+			http.Error(w, "Could not revoke API key", http.StatusInternalServerError)
+			return
+		}
+
+		if revoked == 0 {
+			http.Error(w, "Couldn't find API key", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "API key successfully revoked!",
+		})
+	})
+
+	return r
+}
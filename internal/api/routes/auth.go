@@ -2,20 +2,24 @@ package routes
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ThEditor/clutter-studio/internal/api/common"
 	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/log"
 	"github.com/ThEditor/clutter-studio/internal/repository"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/httprate"
 )
 
 type RegisterRequest struct {
-	Username string `json:"username" validate:"required,min=2"`
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Username        string `json:"username" validate:"required,min=2"`
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required,min=6"`
+	InvitationToken string `json:"invitation_token"`
 }
 
 type LoginRequest struct {
@@ -27,6 +31,19 @@ type VerifyRequest struct {
 	Code string `json:"code" validate:"required,min=6,max=6"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
 func AuthRouter(s *common.Server) http.Handler {
 	r := chi.NewRouter()
 	r.Use(httprate.LimitByIP(5, time.Minute))
@@ -70,18 +87,30 @@ func AuthRouter(s *common.Server) http.Handler {
 			common.SendVerificationMail(*s.Mailer, user.Email, verifyCode.Code)
 		}
 
-		jwt, err := common.CreateJWT(user.ID, user.Email, user.EmailVerified)
+		// signing up through an invitation link accepts it right away
+		if req.InvitationToken != "" {
+			invitation, err := s.Repo.FindValidInvitationByTokenHash(s.Ctx, common.HashToken(req.InvitationToken))
+			if err == nil && strings.EqualFold(invitation.Email, user.Email) {
+				if err := acceptInvitation(s, invitation, user.ID); err != nil {
+					log.Warn("Failed to accept invitation " + invitation.ID.String() + ": " + err.Error())
+				}
+			}
+		}
+
+		jwt, refreshToken, err := startSession(s, r, user)
 
 		if err != nil {
-			http.Error(w, "Failed creating JWT", http.StatusInternalServerError)
+			http.Error(w, "Failed creating session", http.StatusInternalServerError)
 			return
 		}
 
 		common.AttachJWTCookie(w, jwt)
+		common.AttachRefreshCookie(w, refreshToken)
 
 		json.NewEncoder(w).Encode(map[string]string{
-			"message":      "Successfully created!",
-			"access_token": jwt,
+			"message":       "Successfully created!",
+			"access_token":  jwt,
+			"refresh_token": refreshToken,
 		})
 	})
 
@@ -104,23 +133,25 @@ func AuthRouter(s *common.Server) http.Handler {
 			return
 		}
 
-		jwt, err := common.CreateJWT(user.ID, user.Email, user.EmailVerified)
+		jwt, refreshToken, err := startSession(s, r, user)
 
 		if err != nil {
-			http.Error(w, "Failed creating JWT", http.StatusInternalServerError)
+			http.Error(w, "Failed creating session", http.StatusInternalServerError)
 			return
 		}
 
 		common.AttachJWTCookie(w, jwt)
+		common.AttachRefreshCookie(w, refreshToken)
 
 		json.NewEncoder(w).Encode(map[string]string{
-			"message":      "Successfully logged in!",
-			"access_token": jwt,
+			"message":       "Successfully logged in!",
+			"access_token":  jwt,
+			"refresh_token": refreshToken,
 		})
 	})
 
 	r.With(httprate.LimitByRealIP(1, time.Minute)).
-		With(middlewares.AuthWithoutEmailVerifiedMiddleware).
+		With(middlewares.AuthWithoutEmailVerifiedMiddleware(s)).
 		Post("/generate-code", func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
 			if !ok {
@@ -162,7 +193,7 @@ func AuthRouter(s *common.Server) http.Handler {
 			})
 		})
 
-	r.With(middlewares.AuthWithoutEmailVerifiedMiddleware).
+	r.With(middlewares.AuthWithoutEmailVerifiedMiddleware(s)).
 		Post("/verify", func(w http.ResponseWriter, r *http.Request) {
 			var req VerifyRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -212,7 +243,7 @@ func AuthRouter(s *common.Server) http.Handler {
 
 			s.Repo.DeleteVerificationCodes(s.Ctx, user.ID)
 
-			jwt, err := common.CreateJWT(user.ID, user.Email, true)
+			jwt, err := common.CreateJWT(claims.SessionID, user.ID, user.Email, true)
 
 			if err != nil {
 				http.Error(w, "Failed creating JWT", http.StatusInternalServerError)
@@ -227,8 +258,143 @@ func AuthRouter(s *common.Server) http.Handler {
 			})
 		})
 
+	r.Post("/forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		var req ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := common.Validate.Struct(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// the response is the same whether or not the account exists
+		user, err := s.Repo.FindUserByEmail(s.Ctx, req.Email)
+		if err == nil {
+			s.Repo.DeletePasswordResetTokens(s.Ctx, user.ID)
+
+			token := common.GenerateRandomCode(32)
+			_, err = s.Repo.CreatePasswordResetToken(s.Ctx, repository.CreatePasswordResetTokenParams{
+				UserID:    user.ID,
+				TokenHash: common.HashToken(token),
+				ExpiresAt: time.Now().Add(common.PasswordResetExpiration),
+			})
+
+			if err != nil {
+				http.Error(w, "Failed to create password reset token", http.StatusInternalServerError)
+				return
+			}
+
+			common.SendPasswordResetMail(*s.Mailer, user.Email, token)
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "If an account exists for this email, a password reset link has been sent!",
+		})
+	})
+
+	r.Post("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		var req ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := common.Validate.Struct(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := s.Repo.ConsumePasswordResetToken(s.Ctx, common.HashToken(req.Token))
+		if err != nil {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		hashedPassword, err := common.HashPassword(req.Password)
+		if err != nil {
+			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+
+		err = s.Repo.UpdateUserPassword(s.Ctx, repository.UpdateUserPasswordParams{
+			Passhash: hashedPassword,
+			ID:       userID,
+		})
+		if err != nil {
+			http.Error(w, "Failed to update password", http.StatusInternalServerError)
+			return
+		}
+
+		s.Repo.DeletePasswordResetTokens(s.Ctx, userID)
+		s.Repo.RevokeUserSessions(s.Ctx, userID)
+
+		common.DetachJWTCookie(w)
+		common.DetachRefreshCookie(w)
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Successfully reset password!",
+		})
+	})
+
+	r.Post("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		refreshToken := readRefreshToken(r)
+		if refreshToken == "" {
+			http.Error(w, "Refresh token not found", http.StatusBadRequest)
+			return
+		}
+
+		tokenHash := common.HashToken(refreshToken)
+		newRefreshToken := common.GenerateRefreshToken()
+
+		session, err := s.Repo.RotateSessionRefreshToken(s.Ctx, repository.RotateSessionRefreshTokenParams{
+			NewRefreshTokenHash: common.HashToken(newRefreshToken),
+			ExpiresAt:           time.Now().Add(common.RefreshTokenExpiration),
+			RefreshTokenHash:    tokenHash,
+		})
+
+		if err != nil {
+			// a rotated out token being presented again means it leaked,
+			// so the whole session is revoked
+			s.Repo.RevokeSessionByPreviousRefreshTokenHash(s.Ctx, tokenHash)
+			common.DetachJWTCookie(w)
+			common.DetachRefreshCookie(w)
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := s.Repo.FindUserByID(s.Ctx, session.UserID)
+		if err != nil {
+			http.Error(w, "Cannot find user", http.StatusInternalServerError)
+			return
+		}
+
+		jwt, err := common.CreateJWT(session.ID, user.ID, user.Email, user.EmailVerified)
+
+		if err != nil {
+			http.Error(w, "Failed creating JWT", http.StatusInternalServerError)
+			return
+		}
+
+		common.AttachJWTCookie(w, jwt)
+		common.AttachRefreshCookie(w, newRefreshToken)
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":       "Successfully refreshed!",
+			"access_token":  jwt,
+			"refresh_token": newRefreshToken,
+		})
+	})
+
 	r.Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if refreshToken := readRefreshToken(r); refreshToken != "" {
+			s.Repo.RevokeSessionByRefreshTokenHash(s.Ctx, common.HashToken(refreshToken))
+		}
+
 		common.DetachJWTCookie(w)
+		common.DetachRefreshCookie(w)
 
 		json.NewEncoder(w).Encode(map[string]string{
 			"message": "Successfully logged out!",
@@ -237,3 +403,47 @@ func AuthRouter(s *common.Server) http.Handler {
 
 	return r
 }
+
+// startSession persists a new session for the user and returns its access
+// and refresh tokens.
+func startSession(s *common.Server, r *http.Request, user repository.User) (string, string, error) {
+	refreshToken := common.GenerateRefreshToken()
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	session, err := s.Repo.CreateSession(s.Ctx, repository.CreateSessionParams{
+		UserID:           user.ID,
+		RefreshTokenHash: common.HashToken(refreshToken),
+		UserAgent:        r.UserAgent(),
+		IpAddress:        ip,
+		ExpiresAt:        time.Now().Add(common.RefreshTokenExpiration),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	jwt, err := common.CreateJWT(session.ID, user.ID, user.Email, user.EmailVerified)
+	if err != nil {
+		return "", "", err
+	}
+
+	return jwt, refreshToken, nil
+}
+
+// readRefreshToken takes the refresh token from its cookie, falling back to
+// the request body for clients that don't keep cookies.
+func readRefreshToken(r *http.Request) string {
+	if cookie, err := r.Cookie("refreshToken"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return ""
+	}
+
+	return req.RefreshToken
+}
@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type AddDomainRequest struct {
+	Domain string `json:"domain" validate:"required,fqdn,lowercase"`
+}
+
+type CollectorDomainsResponse struct {
+	SiteID  uuid.UUID `json:"site_id"`
+	Domains []string  `json:"domains"`
+}
+
+// loadSiteDomains returns the primary domain of a site followed by its
+// aliases.
+func loadSiteDomains(s *common.Server, site *repository.Site) ([]string, error) {
+	domains, err := s.Repo.ListSiteDomains(s.Ctx, site.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		res = append(res, domain.Domain)
+	}
+	return res, nil
+}
+
+// domainAvailable reports whether domain is free to be used by the site,
+// writing the error response itself when it is not.
+func domainAvailable(s *common.Server, w http.ResponseWriter, siteID uuid.UUID, domain string) bool {
+	existing, err := s.Repo.FindSiteDomain(s.Ctx, domain)
+	if err == nil && existing.SiteID != siteID {
+		http.Error(w, "Domain is already used by another site", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// DomainsRouter serves the primary domain and aliases of the site in the
+// {id} URL parameter.
+func DomainsRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			domains, err := s.Repo.ListSiteDomains(s.Ctx, site.ID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of domains", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(domains)
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Post("/", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req AddDomainRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if !domainAvailable(s, w, site.ID, req.Domain) {
+				return
+			}
+
+			domain, err := s.Repo.AddSiteAlias(s.Ctx, repository.AddSiteAliasParams{
+				SiteID: site.ID,
+				Domain: req.Domain,
+			})
+			if err != nil {
+				http.Error(w, "Domain is already used by a site", http.StatusConflict)
+				return
+			}
+
+			json.NewEncoder(w).Encode(domain)
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Delete("/{domain}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			domain := chi.URLParam(r, "domain")
+			if domain == site.SiteUrl {
+				http.Error(w, "The primary domain cannot be removed", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := s.Repo.DeleteSiteAlias(s.Ctx, repository.DeleteSiteAliasParams{
+				SiteID: site.ID,
+				Domain: domain,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't delete domain", http.StatusInternalServerError)
+				return
+			}
+
+			if deleted == 0 {
+				http.Error(w, "Couldn't find domain", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Domain " + domain + " successfully removed!",
+			})
+		})
+
+	return r
+}
+
+// CollectorRouter serves the Paper collector, which checks the origin of
+// incoming events against the domains of their site.
+func CollectorRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middlewares.CollectorAuthMiddleware)
+
+	r.Get("/sites/{id}/domains", func(w http.ResponseWriter, r *http.Request) {
+		siteId, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Invalid UUID", http.StatusBadRequest)
+			return
+		}
+
+		site, err := s.Repo.FindSiteByID(s.Ctx, siteId)
+		if err != nil {
+			http.Error(w, "Couldn't find site", http.StatusNotFound)
+			return
+		}
+
+		domains, err := loadSiteDomains(s, &site)
+		if err != nil {
+			http.Error(w, "Couldn't fetch list of domains", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(CollectorDomainsResponse{
+			SiteID:  site.ID,
+			Domains: domains,
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,246 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/ThEditor/clutter-studio/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type FunnelStepRequest struct {
+	Name    string `json:"name" validate:"max=100"`
+	Kind    string `json:"kind" validate:"required,oneof=event page"`
+	Pattern string `json:"pattern" validate:"required,max=2048"`
+}
+
+type FunnelRequest struct {
+	Name          string              `json:"name" validate:"required,max=100"`
+	WindowMinutes int32               `json:"window_minutes" validate:"omitempty,min=1,max=43200"`
+	Steps         []FunnelStepRequest `json:"steps" validate:"required,min=2,max=8,dive"`
+}
+
+type FunnelReportResponse struct {
+	ID            uuid.UUID                 `json:"id"`
+	Name          string                    `json:"name"`
+	WindowMinutes int32                     `json:"window_minutes"`
+	From          time.Time                 `json:"from"`
+	To            time.Time                 `json:"to"`
+	Steps         []storage.FunnelStepStats `json:"steps"`
+}
+
+// default time a visitor has to complete a funnel after its first step
+const defaultFunnelWindowMinutes = 24 * 60
+
+// funnelFromRequest decodes and validates a funnel definition, returning its
+// window and steps encoded for storage.
+func funnelFromRequest(w http.ResponseWriter, r *http.Request) (*FunnelRequest, json.RawMessage, bool) {
+	var req FunnelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	if err := common.Validate.Struct(req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	steps := make([]storage.FunnelStep, 0, len(req.Steps))
+	for _, step := range req.Steps {
+		if step.Kind == storage.GoalKindPage && !strings.HasPrefix(step.Pattern, "/") {
+			http.Error(w, "Page steps must match a path starting with /", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		if step.Name == "" {
+			step.Name = step.Pattern
+		}
+		steps = append(steps, storage.FunnelStep{Name: step.Name, Kind: step.Kind, Pattern: step.Pattern})
+	}
+
+	if req.WindowMinutes == 0 {
+		req.WindowMinutes = defaultFunnelWindowMinutes
+	}
+
+	encoded, err := json.Marshal(steps)
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	return &req, encoded, true
+}
+
+// FunnelsRouter serves the funnels of the site in the {id} URL parameter.
+func FunnelsRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			funnels, err := s.Repo.ListFunnelsBySiteID(s.Ctx, site.ID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of funnels", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(funnels)
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Post("/", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			req, steps, ok := funnelFromRequest(w, r)
+			if !ok {
+				return
+			}
+
+			funnel, err := s.Repo.CreateFunnel(s.Ctx, repository.CreateFunnelParams{
+				SiteID:        site.ID,
+				Name:          req.Name,
+				WindowMinutes: req.WindowMinutes,
+				Steps:         steps,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't create funnel", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(funnel)
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{funnelId}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			funnelId, err := uuid.Parse(chi.URLParam(r, "funnelId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			funnel, err := s.Repo.FindFunnelByID(s.Ctx, repository.FindFunnelByIDParams{
+				ID:     funnelId,
+				SiteID: site.ID,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't find funnel", http.StatusNotFound)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			var steps []storage.FunnelStep
+			if err := json.Unmarshal(funnel.Steps, &steps); err != nil {
+				http.Error(w, "Couldn't read funnel steps", http.StatusInternalServerError)
+				return
+			}
+
+			stats, err := s.ClickHouse.GetFunnel(query.Query, steps, time.Duration(funnel.WindowMinutes)*time.Minute)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(FunnelReportResponse{
+				ID:            funnel.ID,
+				Name:          funnel.Name,
+				WindowMinutes: funnel.WindowMinutes,
+				From:          query.Query.Range.From,
+				To:            query.Query.Range.To,
+				Steps:         stats,
+			})
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Put("/{funnelId}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			funnelId, err := uuid.Parse(chi.URLParam(r, "funnelId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			req, steps, ok := funnelFromRequest(w, r)
+			if !ok {
+				return
+			}
+
+			funnel, err := s.Repo.UpdateFunnel(s.Ctx, repository.UpdateFunnelParams{
+				ID:            funnelId,
+				SiteID:        site.ID,
+				Name:          req.Name,
+				WindowMinutes: req.WindowMinutes,
+				Steps:         steps,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't find funnel", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(funnel)
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Delete("/{funnelId}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			funnelId, err := uuid.Parse(chi.URLParam(r, "funnelId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := s.Repo.DeleteFunnel(s.Ctx, repository.DeleteFunnelParams{
+				ID:     funnelId,
+				SiteID: site.ID,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't delete funnel", http.StatusInternalServerError)
+				return
+			}
+
+			if deleted == 0 {
+				http.Error(w, "Couldn't find funnel", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Funnel successfully deleted!",
+			})
+		})
+
+	return r
+}
@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/ThEditor/clutter-studio/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type CreateGoalRequest struct {
+	Name    string `json:"name" validate:"required,max=100"`
+	Kind    string `json:"kind" validate:"required,oneof=event page"`
+	Pattern string `json:"pattern" validate:"required,max=2048"`
+}
+
+// storageGoals converts the goals of a site for conversion queries.
+func storageGoals(goals []repository.Goal) []storage.Goal {
+	res := make([]storage.Goal, 0, len(goals))
+	for _, goal := range goals {
+		res = append(res, storage.Goal{
+			Name:    goal.Name,
+			Kind:    goal.Kind,
+			Pattern: goal.Pattern,
+		})
+	}
+	return res
+}
+
+// GoalsRouter serves the goals of the site in the {id} URL parameter.
+func GoalsRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			goals, err := s.Repo.ListGoalsBySiteID(s.Ctx, site.ID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of goals", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(goals)
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Post("/", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req CreateGoalRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if req.Kind == storage.GoalKindPage && !strings.HasPrefix(req.Pattern, "/") {
+				http.Error(w, "Page goals must match a path starting with /", http.StatusBadRequest)
+				return
+			}
+
+			goal, err := s.Repo.CreateGoal(s.Ctx, repository.CreateGoalParams{
+				SiteID:  site.ID,
+				Name:    req.Name,
+				Kind:    req.Kind,
+				Pattern: req.Pattern,
+			})
+			if err != nil {
+				http.Error(w, "A goal with this name already exists", http.StatusConflict)
+				return
+			}
+
+			json.NewEncoder(w).Encode(goal)
+		})
+
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Delete("/{goalId}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			goalId, err := uuid.Parse(chi.URLParam(r, "goalId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := s.Repo.DeleteGoal(s.Ctx, repository.DeleteGoalParams{
+				ID:     goalId,
+				SiteID: site.ID,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't delete goal", http.StatusInternalServerError)
+				return
+			}
+
+			if deleted == 0 {
+				http.Error(w, "Couldn't find goal", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Goal successfully deleted!",
+			})
+		})
+
+	return r
+}
@@ -0,0 +1,181 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type SiteInvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type OrganizationInvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin viewer"`
+}
+
+type InvitationTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type InvitationResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newInvitationResponses(invitations []repository.Invitation) []InvitationResponse {
+	res := make([]InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		res = append(res, InvitationResponse{
+			ID:        invitation.ID,
+			Email:     invitation.Email,
+			Role:      invitation.Role,
+			ExpiresAt: invitation.ExpiresAt,
+			CreatedAt: invitation.CreatedAt,
+		})
+	}
+	return res
+}
+
+// invite stores an invitation to either a site or an organization, replacing
+// any pending one for the same email and target, and mails its token.
+func invite(s *common.Server, claims *common.Claims, email string, siteID pgtype.UUID, orgID pgtype.UUID, role string, target string) error {
+	inviter, err := s.Repo.FindUserByID(s.Ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	email = strings.ToLower(email)
+	s.Repo.DeletePendingInvitations(s.Ctx, repository.DeletePendingInvitationsParams{
+		Email:          email,
+		SiteID:         siteID,
+		OrganizationID: orgID,
+	})
+
+	token := common.GenerateRandomCode(32)
+	_, err = s.Repo.CreateInvitation(s.Ctx, repository.CreateInvitationParams{
+		Email:          email,
+		SiteID:         siteID,
+		OrganizationID: orgID,
+		Role:           role,
+		TokenHash:      common.HashToken(token),
+		InvitedBy:      inviter.ID,
+		ExpiresAt:      time.Now().Add(common.InvitationExpiration),
+	})
+	if err != nil {
+		return err
+	}
+
+	return common.SendInvitationMail(*s.Mailer, email, inviter.Username, target, token)
+}
+
+// acceptInvitation grants the user access to whatever the invitation targets
+// and deletes it.
+func acceptInvitation(s *common.Server, invitation repository.Invitation, userID uuid.UUID) error {
+	var err error
+	if invitation.SiteID.Valid {
+		err = s.Repo.AddSiteMember(s.Ctx, repository.AddSiteMemberParams{
+			SiteID: invitation.SiteID.Bytes,
+			UserID: userID,
+			Role:   invitation.Role,
+		})
+	} else {
+		// existing members keep their role
+		err = s.Repo.AddOrganizationMemberIfAbsent(s.Ctx, repository.AddOrganizationMemberIfAbsentParams{
+			OrganizationID: invitation.OrganizationID.Bytes,
+			UserID:         userID,
+			Role:           invitation.Role,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.Repo.DeleteInvitation(s.Ctx, invitation.ID)
+}
+
+func InvitationsRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(middlewares.AuthWithoutEmailVerifiedMiddleware(s)).
+		Post("/accept", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req InvitationTokenRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			invitation, err := s.Repo.FindValidInvitationByTokenHash(s.Ctx, common.HashToken(req.Token))
+			if err != nil {
+				http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+				return
+			}
+
+			if !strings.EqualFold(invitation.Email, claims.Email) {
+				http.Error(w, "This invitation was sent to a different email", http.StatusForbidden)
+				return
+			}
+
+			if err := acceptInvitation(s, invitation, claims.UserID); err != nil {
+				http.Error(w, "Couldn't accept invitation", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Invitation successfully accepted!",
+			})
+		})
+
+	r.Post("/decline", func(w http.ResponseWriter, r *http.Request) {
+		var req InvitationTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := common.Validate.Struct(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		invitation, err := s.Repo.FindValidInvitationByTokenHash(s.Ctx, common.HashToken(req.Token))
+		if err != nil {
+			http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.Repo.DeleteInvitation(s.Ctx, invitation.ID); err != nil {
+			http.Error(w, "Couldn't decline invitation", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Invitation successfully declined!",
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,472 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type OrganizationRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=255"`
+}
+
+type AddMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin viewer"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin viewer"`
+}
+
+type OrganizationResponse struct {
+	Organization *repository.Organization                `json:"organization"`
+	Role         string                                  `json:"role"`
+	Members      []repository.ListOrganizationMembersRow `json:"members"`
+}
+
+func OrganizationsRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middlewares.AuthMiddleware(s))
+
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req OrganizationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := common.Validate.Struct(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := s.DB.Begin(s.Ctx)
+		if err != nil {
+			http.Error(w, "Couldn't create organization", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(s.Ctx)
+		qtx := s.Repo.WithTx(tx)
+
+		org, err := qtx.CreateOrganization(s.Ctx, req.Name)
+		if err != nil {
+			http.Error(w, "Couldn't create organization", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = qtx.AddOrganizationMember(s.Ctx, repository.AddOrganizationMemberParams{
+			OrganizationID: org.ID,
+			UserID:         claims.UserID,
+			Role:           common.RoleOwner,
+		})
+		if err != nil {
+			http.Error(w, "Couldn't create organization", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(s.Ctx); err != nil {
+			http.Error(w, "Couldn't create organization", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"organization_id": org.ID.String(),
+			"message":         "Organization " + org.Name + " created successfully!",
+		})
+	})
+
+	r.Get("/all", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		orgs, err := s.Repo.ListOrganizationsByUserID(s.Ctx, claims.UserID)
+		if err != nil {
+			http.Error(w, "Couldn't fetch list of organizations", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(orgs)
+	})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleViewer)).
+		Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			members, err := s.Repo.ListOrganizationMembers(s.Ctx, org.ID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of members", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(&OrganizationResponse{
+				Organization: org,
+				Role:         r.Context().Value(middlewares.RoleKey).(string),
+				Members:      members,
+			})
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleAdmin)).
+		Put("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req OrganizationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			updated, err := s.Repo.UpdateOrganizationName(s.Ctx, repository.UpdateOrganizationNameParams{
+				Name: req.Name,
+				ID:   org.ID,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't update organization", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(updated)
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleOwner)).
+		Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			sites, err := s.Repo.ListSitesByOrganizationID(s.Ctx, org.ID)
+			if err != nil {
+				http.Error(w, "Could not delete organization", http.StatusInternalServerError)
+				return
+			}
+
+			if len(sites) > 0 {
+				http.Error(w, "Organization still owns sites", http.StatusConflict)
+				return
+			}
+
+			if err := s.Repo.DeleteOrganization(s.Ctx, org.ID); err != nil {
+				http.Error(w, "Could not delete organization", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Organization " + org.Name + " successfully deleted!",
+			})
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleViewer)).
+		Get("/{id}/sites", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			sites, err := s.Repo.ListSitesByOrganizationID(s.Ctx, org.ID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of sites", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(sites)
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleAdmin)).
+		Post("/{id}/members", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req AddMemberRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if !common.HasRole(r.Context().Value(middlewares.RoleKey).(string), req.Role) {
+				http.Error(w, "You cannot grant a role above your own", http.StatusForbidden)
+				return
+			}
+
+			user, err := s.Repo.FindUserByEmail(s.Ctx, req.Email)
+			if err != nil {
+				http.Error(w, "Cannot find user", http.StatusNotFound)
+				return
+			}
+
+			_, err = s.Repo.AddOrganizationMember(s.Ctx, repository.AddOrganizationMemberParams{
+				OrganizationID: org.ID,
+				UserID:         user.ID,
+				Role:           req.Role,
+			})
+			if err != nil {
+				http.Error(w, "User is already a member of this organization", http.StatusConflict)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": user.Username + " added to " + org.Name + " successfully!",
+			})
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleAdmin)).
+		Post("/{id}/invitations", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req OrganizationInvitationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if !common.HasRole(r.Context().Value(middlewares.RoleKey).(string), req.Role) {
+				http.Error(w, "You cannot grant a role above your own", http.StatusForbidden)
+				return
+			}
+
+			err := invite(s, claims, req.Email, pgtype.UUID{}, pgtype.UUID{Bytes: org.ID, Valid: true}, req.Role, "join "+org.Name)
+			if err != nil {
+				http.Error(w, "Couldn't send invitation", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Invitation sent to " + req.Email + "!",
+			})
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleAdmin)).
+		Get("/{id}/invitations", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			invitations, err := s.Repo.ListPendingInvitationsByOrganizationID(s.Ctx, pgtype.UUID{Bytes: org.ID, Valid: true})
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of invitations", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(newInvitationResponses(invitations))
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleAdmin)).
+		Delete("/{id}/invitations/{invitationId}", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			invitationId, err := uuid.Parse(chi.URLParam(r, "invitationId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := s.Repo.DeleteOrganizationInvitation(s.Ctx, repository.DeleteOrganizationInvitationParams{
+				ID:             invitationId,
+				OrganizationID: pgtype.UUID{Bytes: org.ID, Valid: true},
+			})
+			if err != nil {
+				http.Error(w, "Couldn't revoke invitation", http.StatusInternalServerError)
+				return
+			}
+
+			if deleted == 0 {
+				http.Error(w, "Couldn't find invitation", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Invitation successfully revoked!",
+			})
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleAdmin)).
+		Put("/{id}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			userId, err := uuid.Parse(chi.URLParam(r, "userId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			var req UpdateMemberRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if status, msg := checkMemberChange(s, r, org, userId); status != http.StatusOK {
+				http.Error(w, msg, status)
+				return
+			}
+
+			if !common.HasRole(r.Context().Value(middlewares.RoleKey).(string), req.Role) {
+				http.Error(w, "You cannot grant a role above your own", http.StatusForbidden)
+				return
+			}
+
+			_, err = s.Repo.UpdateOrganizationMemberRole(s.Ctx, repository.UpdateOrganizationMemberRoleParams{
+				Role:           req.Role,
+				OrganizationID: org.ID,
+				UserID:         userId,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't update member", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Member successfully updated!",
+			})
+		})
+
+	r.With(middlewares.OrganizationAccess(s, common.RoleViewer)).
+		Delete("/{id}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			org, ok := r.Context().Value(middlewares.OrganizationKey).(*repository.Organization)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			userId, err := uuid.Parse(chi.URLParam(r, "userId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			// anyone may leave, removing others takes an admin
+			role := r.Context().Value(middlewares.RoleKey).(string)
+			if userId != claims.UserID && !common.HasRole(role, common.RoleAdmin) {
+				http.Error(w, "You do not have access to this organization", http.StatusForbidden)
+				return
+			}
+
+			if status, msg := checkMemberChange(s, r, org, userId); status != http.StatusOK {
+				http.Error(w, msg, status)
+				return
+			}
+
+			_, err = s.Repo.RemoveOrganizationMember(s.Ctx, repository.RemoveOrganizationMemberParams{
+				OrganizationID: org.ID,
+				UserID:         userId,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't remove member", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Member successfully removed!",
+			})
+		})
+
+	return r
+}
+
+// checkMemberChange guards updates to an existing membership: only owners may
+// touch other owners, and an organization can never lose its last owner.
+func checkMemberChange(s *common.Server, r *http.Request, org *repository.Organization, userId uuid.UUID) (int, string) {
+	claims := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+	role := r.Context().Value(middlewares.RoleKey).(string)
+
+	memberRole, err := s.Repo.FindOrganizationMemberRole(s.Ctx, repository.FindOrganizationMemberRoleParams{
+		OrganizationID: org.ID,
+		UserID:         userId,
+	})
+	if err != nil {
+		return http.StatusNotFound, "Couldn't find member"
+	}
+
+	if memberRole != common.RoleOwner {
+		return http.StatusOK, ""
+	}
+
+	if role != common.RoleOwner && userId != claims.UserID {
+		return http.StatusForbidden, "Only owners can change other owners"
+	}
+
+	owners, err := s.Repo.CountOrganizationOwners(s.Ctx, org.ID)
+	if err != nil {
+		return http.StatusInternalServerError, "Couldn't check organization owners"
+	}
+
+	if owners <= 1 {
+		return http.StatusConflict, "An organization needs at least one owner"
+	}
+
+	return http.StatusOK, ""
+}
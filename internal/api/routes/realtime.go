@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/ThEditor/clutter-studio/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// how often a realtime stream pushes fresh counts
+const realtimeInterval = 5 * time.Second
+
+// most realtime streams open at once, overall and per user
+const (
+	maxRealtimeStreams        = 200
+	maxRealtimeStreamsPerUser = 5
+)
+
+// number of pages and referrers listed in realtime stats
+const realtimeLimit = 10
+
+// streamLimiter caps the number of concurrently open streams.
+type streamLimiter struct {
+	mu      sync.Mutex
+	total   int
+	perUser map[uuid.UUID]int
+}
+
+func (l *streamLimiter) acquire(userID uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.total >= maxRealtimeStreams || l.perUser[userID] >= maxRealtimeStreamsPerUser {
+		return false
+	}
+
+	l.total++
+	l.perUser[userID]++
+	return true
+}
+
+func (l *streamLimiter) release(userID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	if l.perUser[userID]--; l.perUser[userID] <= 0 {
+		delete(l.perUser, userID)
+	}
+}
+
+// streamAuthorized checks again that the credentials a stream was opened
+// with are still valid and still grant access to the site.
+func streamAuthorized(s *common.Server, r *http.Request, site *repository.Site) bool {
+	claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+	if !ok {
+		return false
+	}
+
+	if apiKey, ok := r.Context().Value(middlewares.APIKeyKey).(*repository.Apikey); ok {
+		if _, err := s.Repo.FindActiveAPIKeyByHash(s.Ctx, apiKey.KeyHash); err != nil {
+			return false
+		}
+	} else if _, err := s.Repo.FindActiveSessionByID(s.Ctx, claims.SessionID); err != nil {
+		return false
+	}
+
+	role, err := s.Repo.FindUserSiteRole(s.Ctx, repository.FindUserSiteRoleParams{
+		SiteID: site.ID,
+		UserID: claims.UserID,
+	})
+	return err == nil && common.HasRole(role, common.RoleViewer)
+}
+
+// getRealtime returns the current visitors of a site with its settings
+// applied.
+func getRealtime(s *common.Server, site *repository.Site) (*storage.RealtimeStats, error) {
+	settings, err := loadSiteSettings(s, site.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := loadSiteDomains(s, site)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := siteQuery(site, settings, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ClickHouse.GetRealtime(query, time.Now().UTC(), realtimeLimit)
+}
+
+// RealtimeRouter serves the current visitors of the site in the {id} URL
+// parameter, once or as a Server-Sent Events stream.
+func RealtimeRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middlewares.SiteAccess(s, common.RoleViewer))
+
+	streams := &streamLimiter{perUser: make(map[uuid.UUID]int)}
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		stats, err := getRealtime(s, site)
+		if err != nil {
+			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(stats)
+	})
+
+	r.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !streams.acquire(claims.UserID) {
+			http.Error(w, "Too many open realtime streams", http.StatusTooManyRequests)
+			return
+		}
+		defer streams.release(claims.UserID)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		ticker := time.NewTicker(realtimeInterval)
+		defer ticker.Stop()
+
+		for {
+			stats, err := getRealtime(s, site)
+			if err == nil {
+				data, _ := json.Marshal(stats)
+				w.Write([]byte("event: realtime\ndata: " + string(data) + "\n\n"))
+			} else {
+				w.Write([]byte("event: error\ndata: \"Couldn't find analytics data for site\"\n\n"))
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+
+			if !streamAuthorized(s, r, site) {
+				w.Write([]byte("event: error\ndata: \"You do not have access to this site\"\n\n"))
+				rc.Flush()
+				return
+			}
+		}
+	})
+
+	return r
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/ThEditor/clutter-studio/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type SiteSettingsRequest struct {
+	SessionTimeoutMinutes int32    `json:"session_timeout_minutes" validate:"required,min=1,max=1440"`
+	Timezone              string   `json:"timezone" validate:"omitempty,ne=Local,timezone"`
+	ExcludedIPs           []string `json:"excluded_ips" validate:"max=100,dive,ip|cidr"`
+	ExcludedPaths         []string `json:"excluded_paths" validate:"max=100,dive,startswith=/,max=2048"`
+}
+
+// timezone every site without one configured reports in
+const defaultTimezone = "UTC"
+
+// loadSiteSettings returns the settings of a site, falling back to the
+// defaults for sites that never saved any.
+func loadSiteSettings(s *common.Server, siteID uuid.UUID) (repository.Sitesetting, error) {
+	settings, err := s.Repo.GetSiteSettings(s.Ctx, siteID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Sitesetting{
+			SiteID:                siteID,
+			SessionTimeoutMinutes: int32(storage.DefaultSessionTimeout.Minutes()),
+			Timezone:              defaultTimezone,
+			ExcludedIps:           []string{},
+			ExcludedPaths:         []string{},
+		}, nil
+	}
+
+	return settings, err
+}
+
+// normalizeExcludedIPs turns the addresses and CIDR ranges of a settings
+// request into canonical CIDR ranges.
+func normalizeExcludedIPs(excluded []string) ([]string, error) {
+	res := make([]string, 0, len(excluded))
+	for _, value := range excluded {
+		var prefix netip.Prefix
+		if strings.Contains(value, "/") {
+			parsed, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, err
+			}
+
+			// IPv4-mapped ranges count their bits from the start of ::ffff:0:0/96
+			bits := parsed.Bits()
+			if parsed.Addr().Is4In6() {
+				if bits < 96 {
+					return nil, fmt.Errorf("IPv4-mapped range %q is wider than ::ffff:0:0/96", value)
+				}
+				bits -= 96
+			}
+			prefix = netip.PrefixFrom(parsed.Addr().Unmap(), bits)
+		} else {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, err
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+
+		if !prefix.IsValid() {
+			return nil, fmt.Errorf("invalid IP range %q", value)
+		}
+
+		normalized := prefix.Masked().String()
+		if !slices.Contains(res, normalized) {
+			res = append(res, normalized)
+		}
+	}
+	return res, nil
+}
+
+// siteQuery returns a query over all events of a site with its settings
+// applied, treating referrals from any of domains as internal.
+func siteQuery(site *repository.Site, settings repository.Sitesetting, domains []string) (storage.Query, error) {
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return storage.Query{}, err
+	}
+
+	return storage.Query{
+		SiteID:         site.ID,
+		SessionTimeout: time.Duration(settings.SessionTimeoutMinutes) * time.Minute,
+		SiteDomains:    domains,
+		Location:       location,
+		ExcludedIPs:    settings.ExcludedIps,
+		ExcludedPaths:  settings.ExcludedPaths,
+	}, nil
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeExcludedIPs(t *testing.T) {
+	tests := []struct {
+		name     string
+		excluded []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "empty", excluded: nil, want: []string{}},
+		{name: "ipv4 address", excluded: []string{"203.0.113.7"}, want: []string{"203.0.113.7/32"}},
+		{name: "ipv6 address", excluded: []string{"2001:db8::1"}, want: []string{"2001:db8::1/128"}},
+		{name: "range is masked", excluded: []string{"10.1.2.3/8"}, want: []string{"10.0.0.0/8"}},
+		{name: "mapped address", excluded: []string{"::ffff:203.0.113.7"}, want: []string{"203.0.113.7/32"}},
+		{name: "mapped range", excluded: []string{"::ffff:10.0.0.0/104"}, want: []string{"10.0.0.0/8"}},
+		{name: "whole mapped space", excluded: []string{"::ffff:0.0.0.0/96"}, want: []string{"0.0.0.0/0"}},
+		{name: "duplicates are dropped", excluded: []string{"10.0.0.0/8", "10.9.9.9/8", "::ffff:10.0.0.0/104"}, want: []string{"10.0.0.0/8"}},
+		{name: "mapped range wider than ipv4", excluded: []string{"::ffff:0:0/80"}, wantErr: true},
+		{name: "prefix too long", excluded: []string{"10.0.0.0/33"}, wantErr: true},
+		{name: "hostname", excluded: []string{"office.example.com"}, wantErr: true},
+		{name: "address with port", excluded: []string{"203.0.113.7:443"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeExcludedIPs(tt.excluded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeExcludedIPs(%q) error = %v, wantErr %v", tt.excluded, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeExcludedIPs(%q) = %q, want %q", tt.excluded, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/api/common"
+	"github.com/ThEditor/clutter-studio/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/httprate"
+	"github.com/google/uuid"
+)
+
+type CreateSharedLinkRequest struct {
+	Password  string     `json:"password" validate:"omitempty,min=6"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type SharedLinkResponse struct {
+	ID                uuid.UUID  `json:"id"`
+	Slug              string     `json:"slug"`
+	PasswordProtected bool       `json:"password_protected"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+func newSharedLinkResponse(link repository.Sharedlink) SharedLinkResponse {
+	res := SharedLinkResponse{
+		ID:                link.ID,
+		Slug:              link.Slug,
+		PasswordProtected: link.Passhash.Valid,
+		CreatedAt:         link.CreatedAt,
+	}
+	if link.ExpiresAt.Valid {
+		res.ExpiresAt = &link.ExpiresAt.Time
+	}
+	return res
+}
+
+// sharedLinkFromRequest resolves the {slug} URL parameter to a live shared
+// link, checking the X-Share-Password header when the link has a password.
+func sharedLinkFromRequest(s *common.Server, w http.ResponseWriter, r *http.Request) (*repository.Sharedlink, bool) {
+	link, err := s.Repo.FindActiveSharedLinkBySlug(s.Ctx, chi.URLParam(r, "slug"))
+	if err != nil {
+		http.Error(w, "Couldn't find shared dashboard", http.StatusNotFound)
+		return nil, false
+	}
+
+	if link.Passhash.Valid && !common.CheckPasswordHash(link.Passhash.String, r.Header.Get("X-Share-Password")) {
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return &link, true
+}
+
+// SharedRouter serves the read-only, unauthenticated dashboards behind
+// shared links.
+func SharedRouter(s *common.Server) http.Handler {
+	r := chi.NewRouter()
+	r.Use(httprate.LimitByRealIP(30, time.Minute))
+
+	r.Get("/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		link, err := s.Repo.FindActiveSharedLinkBySlug(s.Ctx, chi.URLParam(r, "slug"))
+		if err != nil {
+			http.Error(w, "Couldn't find shared dashboard", http.StatusNotFound)
+			return
+		}
+
+		site, err := s.Repo.FindSiteByID(s.Ctx, link.SiteID)
+		if err != nil {
+			http.Error(w, "Couldn't find site", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"site_url":           site.SiteUrl,
+			"password_protected": link.Passhash.Valid,
+		})
+	})
+
+	r.Get("/{slug}/analytics", func(w http.ResponseWriter, r *http.Request) {
+		link, ok := sharedLinkFromRequest(s, w, r)
+		if !ok {
+			return
+		}
+
+		site, err := s.Repo.FindSiteByID(s.Ctx, link.SiteID)
+		if err != nil {
+			http.Error(w, "Couldn't find site", http.StatusNotFound)
+			return
+		}
+
+		query, ok := analyticsQueryFromRequest(s, w, r, &site)
+		if !ok {
+			return
+		}
+
+		analytics, err := siteAnalytics(s, query)
+		if err != nil {
+			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(analytics)
+	})
+
+	return r
+}
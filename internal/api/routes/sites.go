@@ -2,7 +2,9 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/ThEditor/clutter-studio/internal/api/common"
 	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
@@ -10,29 +12,22 @@ import (
 	"github.com/ThEditor/clutter-studio/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type CreateRequest struct {
-	SiteUrl string `json:"site_url" validate:"required,fqdn,lowercase"`
-}
-
-type AnalyticsRequest struct {
-	From string `json:"from" validate:"YYYYMMDDdate"`
-	To   string `json:"to" validate:"YYYYMMDDdate"`
+	SiteUrl        string `json:"site_url" validate:"required,fqdn,lowercase"`
+	OrganizationID string `json:"organization_id" validate:"omitempty,uuid"`
 }
 
-type AnalyticsResponse struct {
-	TopPages       []storage.PageStats     `json:"top_pages"`
-	DeviceStats    []storage.DeviceStats   `json:"device_stats"`
-	PageViews      int                     `json:"page_views"`
-	TopReferrers   []storage.ReferrerStats `json:"top_referrers"`
-	UniqueVisitors int                     `json:"unique_visitors"`
-	VisitorGraph   []storage.VisitorStats  `json:"visitor_graph"`
+type UpdateSiteRequest struct {
+	SiteUrl string `json:"site_url" validate:"required,fqdn,lowercase"`
 }
 
 func SitesRouter(s *common.Server) http.Handler {
 	r := chi.NewRouter()
-	r.Use(middlewares.AuthMiddleware)
+	r.Use(middlewares.APIKeyOrAuthMiddleware(s))
 
 	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
 		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
@@ -54,19 +49,57 @@ func SitesRouter(s *common.Server) http.Handler {
 
 		userId := claims.UserID
 
-		_, err := s.Repo.FindSiteByUserIDAndURL(s.Ctx, repository.FindSiteByUserIDAndURLParams{
-			UserID:  userId,
-			SiteUrl: req.SiteUrl,
+		var org repository.Organization
+		var err error
+		if req.OrganizationID != "" {
+			org, err = s.Repo.FindOrganizationByID(s.Ctx, uuid.MustParse(req.OrganizationID))
+			if err != nil {
+				http.Error(w, "Couldn't find organization", http.StatusNotFound)
+				return
+			}
+
+			role, err := s.Repo.FindOrganizationMemberRole(s.Ctx, repository.FindOrganizationMemberRoleParams{
+				OrganizationID: org.ID,
+				UserID:         userId,
+			})
+			if err != nil || !common.HasRole(role, common.RoleAdmin) {
+				http.Error(w, "You do not have access to this organization", http.StatusForbidden)
+				return
+			}
+		} else {
+			org, err = defaultOrganization(s, claims)
+			if err != nil {
+				http.Error(w, "Couldn't create organization", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		_, err = s.Repo.FindSiteByOrganizationIDAndURL(s.Ctx, repository.FindSiteByOrganizationIDAndURLParams{
+			OrganizationID: org.ID,
+			SiteUrl:        req.SiteUrl,
 		})
 
 		if err == nil {
-			http.Error(w, "Site already exists for this user", http.StatusConflict)
+			http.Error(w, "Site already exists in this organization", http.StatusConflict)
 			return
 		}
 
-		site, err := s.Repo.CreateSite(s.Ctx, repository.CreateSiteParams{
-			UserID:  userId,
-			SiteUrl: req.SiteUrl,
+		if !domainAvailable(s, w, uuid.Nil, req.SiteUrl) {
+			return
+		}
+
+		tx, err := s.DB.Begin(s.Ctx)
+		if err != nil {
+			http.Error(w, "Couldn't create site", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback(s.Ctx)
+		qtx := s.Repo.WithTx(tx)
+
+		site, err := qtx.CreateSite(s.Ctx, repository.CreateSiteParams{
+			UserID:         userId,
+			OrganizationID: org.ID,
+			SiteUrl:        req.SiteUrl,
 		})
 
 		if err != nil {
@@ -74,6 +107,20 @@ func SitesRouter(s *common.Server) http.Handler {
 			return
 		}
 
+		err = qtx.SetSitePrimaryDomain(s.Ctx, repository.SetSitePrimaryDomainParams{
+			SiteID: site.ID,
+			Domain: site.SiteUrl,
+		})
+		if err != nil {
+			http.Error(w, "Domain is already used by another site", http.StatusConflict)
+			return
+		}
+
+		if err := tx.Commit(s.Ctx); err != nil {
+			http.Error(w, "Couldn't create site", http.StatusInternalServerError)
+			return
+		}
+
 		json.NewEncoder(w).Encode(map[string]string{
 			"site_id": site.ID.String(),
 			"message": "Site " + site.SiteUrl + " added successfully!",
@@ -97,158 +144,713 @@ func SitesRouter(s *common.Server) http.Handler {
 		json.NewEncoder(w).Encode(sites)
 	})
 
-	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		siteId, err := uuid.Parse(chi.URLParam(r, "id"))
-		if err != nil {
-			http.Error(w, "Invalid UUID", http.StatusBadRequest)
-			return
-		}
-
-		site, err := s.Repo.FindSiteByID(s.Ctx, siteId)
-
-		if err != nil {
-			http.Error(w, "Couldn't find site", http.StatusNotFound)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
 
-		if site.UserID != claims.UserID {
-			http.Error(w, "You do not have access to this site", http.StatusForbidden)
-			return
-		}
-
-		json.NewEncoder(w).Encode(site)
-	})
+			json.NewEncoder(w).Encode(site)
+		})
 
-	r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Put("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req UpdateSiteRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if req.SiteUrl == site.SiteUrl {
+				json.NewEncoder(w).Encode(site)
+				return
+			}
+
+			_, err := s.Repo.FindSiteByOrganizationIDAndURL(s.Ctx, repository.FindSiteByOrganizationIDAndURLParams{
+				OrganizationID: site.OrganizationID,
+				SiteUrl:        req.SiteUrl,
+			})
+
+			if err == nil {
+				http.Error(w, "Site already exists in this organization", http.StatusConflict)
+				return
+			}
+
+			if !domainAvailable(s, w, site.ID, req.SiteUrl) {
+				return
+			}
+
+			tx, err := s.DB.Begin(s.Ctx)
+			if err != nil {
+				http.Error(w, "Couldn't update site", http.StatusInternalServerError)
+				return
+			}
+			defer tx.Rollback(s.Ctx)
+			qtx := s.Repo.WithTx(tx)
+
+			// referrals from the old domain stay internal navigation
+			err = qtx.DemoteSitePrimaryDomain(s.Ctx, site.ID)
+			if err != nil {
+				http.Error(w, "Couldn't update site", http.StatusInternalServerError)
+				return
+			}
+
+			err = qtx.KeepSiteAlias(s.Ctx, repository.KeepSiteAliasParams{
+				SiteID: site.ID,
+				Domain: site.SiteUrl,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't update site", http.StatusInternalServerError)
+				return
+			}
+
+			updated, err := qtx.UpdateSiteURL(s.Ctx, repository.UpdateSiteURLParams{
+				SiteUrl: req.SiteUrl,
+				ID:      site.ID,
+			})
+			if isUniqueViolation(err) {
+				http.Error(w, "Site already exists in this organization", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Couldn't update site", http.StatusInternalServerError)
+				return
+			}
+
+			err = qtx.SetSitePrimaryDomain(s.Ctx, repository.SetSitePrimaryDomainParams{
+				SiteID: updated.ID,
+				Domain: updated.SiteUrl,
+			})
+			if err != nil {
+				http.Error(w, "Domain is already used by another site", http.StatusConflict)
+				return
+			}
+
+			if err := tx.Commit(s.Ctx); err != nil {
+				http.Error(w, "Couldn't update site", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(updated)
+		})
 
-		siteId, err := uuid.Parse(chi.URLParam(r, "id"))
-		if err != nil {
-			http.Error(w, "Invalid UUID", http.StatusBadRequest)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
 
-		site, err := s.Repo.FindSiteByID(s.Ctx, siteId)
+			err := s.Repo.DeleteSite(s.Ctx, site.ID)
 
-		if err != nil {
-			http.Error(w, "Couldn't find site", http.StatusNotFound)
-			return
-		}
+			if err != nil {
+				http.Error(w, "Could not delete site", http.StatusInternalServerError)
+				return
+			}
 
-		if site.UserID != claims.UserID {
-			http.Error(w, "You do not have access to this site", http.StatusForbidden)
-			return
-		}
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Site " + site.SiteUrl + " successfully deleted!",
+			})
+		})
 
-		err = s.Repo.DeleteSite(s.Ctx, repository.DeleteSiteParams{
-			ID:     siteId,
-			UserID: claims.UserID,
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Get("/{id}/members", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			members, err := s.Repo.ListSiteMembers(s.Ctx, site.ID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of members", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(members)
 		})
 
-		if err != nil {
-			http.Error(w, "Could not delete site", http.StatusInternalServerError)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Delete("/{id}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			userId, err := uuid.Parse(chi.URLParam(r, "userId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			removed, err := s.Repo.RemoveSiteMember(s.Ctx, repository.RemoveSiteMemberParams{
+				SiteID: site.ID,
+				UserID: userId,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't remove member", http.StatusInternalServerError)
+				return
+			}
+
+			if removed == 0 {
+				http.Error(w, "Couldn't find member", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Member successfully removed!",
+			})
+		})
 
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "Site " + site.SiteUrl + " successfully deleted!",
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Post("/{id}/invitations", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req SiteInvitationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			err := invite(s, claims, req.Email, pgtype.UUID{Bytes: site.ID, Valid: true}, pgtype.UUID{}, common.RoleViewer, "view "+site.SiteUrl)
+			if err != nil {
+				http.Error(w, "Couldn't send invitation", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Invitation sent to " + req.Email + "!",
+			})
 		})
-	})
 
-	r.Get("/{id}/analytics", func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Get("/{id}/invitations", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			invitations, err := s.Repo.ListPendingInvitationsBySiteID(s.Ctx, pgtype.UUID{Bytes: site.ID, Valid: true})
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of invitations", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(newInvitationResponses(invitations))
+		})
 
-		siteId, err := uuid.Parse(chi.URLParam(r, "id"))
-		if err != nil {
-			http.Error(w, "Invalid UUID", http.StatusBadRequest)
-			return
-		}
-		var req AnalyticsRequest
-		req.From = r.URL.Query().Get("from")
-		req.To = r.URL.Query().Get("to")
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Delete("/{id}/invitations/{invitationId}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			invitationId, err := uuid.Parse(chi.URLParam(r, "invitationId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := s.Repo.DeleteSiteInvitation(s.Ctx, repository.DeleteSiteInvitationParams{
+				ID:     invitationId,
+				SiteID: pgtype.UUID{Bytes: site.ID, Valid: true},
+			})
+			if err != nil {
+				http.Error(w, "Couldn't revoke invitation", http.StatusInternalServerError)
+				return
+			}
+
+			if deleted == 0 {
+				http.Error(w, "Couldn't find invitation", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Invitation successfully revoked!",
+			})
+		})
 
-		if err := common.Validate.Struct(req); err != nil {
-			http.Error(w, "Invalid query parameters", http.StatusBadRequest)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Post("/{id}/shared-links", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req CreateSharedLinkRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			params := repository.CreateSharedLinkParams{
+				SiteID:    site.ID,
+				Slug:      common.GenerateRandomCode(16),
+				CreatedBy: claims.UserID,
+			}
+
+			if req.Password != "" {
+				hashedPassword, err := common.HashPassword(req.Password)
+				if err != nil {
+					http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+					return
+				}
+				params.Passhash = pgtype.Text{String: hashedPassword, Valid: true}
+			}
+
+			if req.ExpiresAt != nil {
+				if req.ExpiresAt.Before(time.Now()) {
+					http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+					return
+				}
+				params.ExpiresAt = pgtype.Timestamptz{Time: *req.ExpiresAt, Valid: true}
+			}
+
+			link, err := s.Repo.CreateSharedLink(s.Ctx, params)
+			if err != nil {
+				http.Error(w, "Couldn't create shared link", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(newSharedLinkResponse(link))
+		})
 
-		site, err := s.Repo.FindSiteByID(s.Ctx, siteId)
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Get("/{id}/shared-links", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			links, err := s.Repo.ListSharedLinksBySiteID(s.Ctx, site.ID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of shared links", http.StatusInternalServerError)
+				return
+			}
+
+			res := make([]SharedLinkResponse, 0, len(links))
+			for _, link := range links {
+				res = append(res, newSharedLinkResponse(link))
+			}
+
+			json.NewEncoder(w).Encode(res)
+		})
 
-		if err != nil {
-			http.Error(w, "Couldn't find site", http.StatusNotFound)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Delete("/{id}/shared-links/{linkId}", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			linkId, err := uuid.Parse(chi.URLParam(r, "linkId"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := s.Repo.DeleteSharedLink(s.Ctx, repository.DeleteSharedLinkParams{
+				ID:     linkId,
+				SiteID: site.ID,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't revoke shared link", http.StatusInternalServerError)
+				return
+			}
+
+			if deleted == 0 {
+				http.Error(w, "Couldn't find shared link", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Shared link successfully revoked!",
+			})
+		})
 
-		if site.UserID != claims.UserID {
-			http.Error(w, "You do not have access to this site", http.StatusForbidden)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			analytics, err := siteAnalytics(s, query)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(analytics)
+		})
 
-		topPages, err := s.ClickHouse.GetTopPages(site.ID, 10)
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics/breakdown", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			breakdown, err := parseBreakdownRequest(r)
+			if err != nil {
+				http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			stats, err := s.ClickHouse.GetSessionBreakdown(query.Query, breakdown.Property, breakdown.Limit, breakdown.Offset)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(stats)
+		})
 
-		if err != nil || topPages == nil {
-			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics/entry-pages", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			pagination, err := parsePagination(r)
+			if err != nil {
+				http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			pages, err := s.ClickHouse.GetEntryPages(query.Query, pagination.Limit, pagination.Offset)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(pages)
+		})
 
-		deviceStats, err := s.ClickHouse.GetDeviceStats(site.ID)
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics/exit-pages", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			pagination, err := parsePagination(r)
+			if err != nil {
+				http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			pages, err := s.ClickHouse.GetExitPages(query.Query, pagination.Limit, pagination.Offset)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(pages)
+		})
 
-		if err != nil || deviceStats == nil {
-			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics/retention", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			req, err := parseRetentionRequest(r)
+			if err != nil {
+				http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			cohorts, err := s.ClickHouse.GetRetention(query.Query, storage.Granularity(req.Granularity), req.Periods)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(cohorts)
+		})
 
-		pageViews, err := s.ClickHouse.GetPageViews(site.ID)
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics/flow", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			req, err := parseFlowRequest(r)
+			if err != nil {
+				http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			flow, err := s.ClickHouse.GetFlow(query.Query, req.Page, storage.FlowDirection(req.Direction), req.Steps, req.Limit)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(flow)
+		})
 
-		if err != nil {
-			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
-			return
-		}
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics/events/properties", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			req, err := parseEventPropertiesRequest(r)
+			if err != nil {
+				http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			stats, err := s.ClickHouse.GetEventProperties(query.Query, req.Event, req.Property, req.Limit, req.Offset)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(stats)
+		})
 
-		topReferrers, err := s.ClickHouse.GetTopReferrers(site.ID, 10)
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/analytics/bots", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			query, ok := analyticsQueryFromRequest(s, w, r, site)
+			if !ok {
+				return
+			}
+
+			pagination, err := parsePagination(r)
+			if err != nil {
+				http.Error(w, "Invalid query parameters: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			traffic, err := s.ClickHouse.GetBotTraffic(query.Query, pagination.Limit, pagination.Offset)
+			if err != nil {
+				http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
+				return
+			}
+
+			json.NewEncoder(w).Encode(traffic)
+		})
 
-		if err != nil || topReferrers == nil {
-			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
-			return
-		}
+	r.Mount("/{id}/goals", GoalsRouter(s))
+	r.Mount("/{id}/funnels", FunnelsRouter(s))
+	r.Mount("/{id}/realtime", RealtimeRouter(s))
+	r.Mount("/{id}/domains", DomainsRouter(s))
+
+	r.With(middlewares.SiteAccess(s, common.RoleViewer)).
+		Get("/{id}/settings", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			settings, err := loadSiteSettings(s, site.ID)
+			if err != nil {
+				http.Error(w, "Couldn't load site settings", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(settings)
+		})
 
-		uniqueVisitors, err := s.ClickHouse.GetUniqueVisitors(site.ID)
+	r.With(middlewares.SiteAccess(s, common.RoleAdmin)).
+		Put("/{id}/settings", func(w http.ResponseWriter, r *http.Request) {
+			site, ok := r.Context().Value(middlewares.SiteKey).(*repository.Site)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var req SiteSettingsRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if err := common.Validate.Struct(req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			if req.Timezone == "" {
+				req.Timezone = defaultTimezone
+			}
+
+			excludedIPs, err := normalizeExcludedIPs(req.ExcludedIPs)
+			if err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			excludedPaths := req.ExcludedPaths
+			if excludedPaths == nil {
+				excludedPaths = []string{}
+			}
+
+			settings, err := s.Repo.UpsertSiteSettings(s.Ctx, repository.UpsertSiteSettingsParams{
+				SiteID:                site.ID,
+				SessionTimeoutMinutes: req.SessionTimeoutMinutes,
+				Timezone:              req.Timezone,
+				ExcludedIps:           excludedIPs,
+				ExcludedPaths:         excludedPaths,
+			})
+			if err != nil {
+				http.Error(w, "Couldn't save site settings", http.StatusInternalServerError)
+				return
+			}
+
+			json.NewEncoder(w).Encode(settings)
+		})
 
-		if err != nil {
-			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
-			return
-		}
+	return r
+}
 
-		visitorGraph, err := s.ClickHouse.GetVisitorGraph(site.ID, req.From, req.To)
+// defaultOrganization returns the first organization the user owns, creating
+// a personal one named after them if there is none yet.
+func defaultOrganization(s *common.Server, claims *common.Claims) (repository.Organization, error) {
+	org, err := s.Repo.FindDefaultOrganizationByUserID(s.Ctx, claims.UserID)
+	if err == nil {
+		return org, nil
+	}
+
+	user, err := s.Repo.FindUserByID(s.Ctx, claims.UserID)
+	if err != nil {
+		return repository.Organization{}, err
+	}
+
+	tx, err := s.DB.Begin(s.Ctx)
+	if err != nil {
+		return repository.Organization{}, err
+	}
+	defer tx.Rollback(s.Ctx)
+	qtx := s.Repo.WithTx(tx)
+
+	org, err = qtx.CreateOrganization(s.Ctx, user.Username)
+	if err != nil {
+		return repository.Organization{}, err
+	}
+
+	_, err = qtx.AddOrganizationMember(s.Ctx, repository.AddOrganizationMemberParams{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           common.RoleOwner,
+	})
+	if err != nil {
+		return repository.Organization{}, err
+	}
 
-		if err != nil || visitorGraph == nil {
-			http.Error(w, "Couldn't find analytics data for site", http.StatusNotFound)
-			return
-		}
+	if err := tx.Commit(s.Ctx); err != nil {
+		return repository.Organization{}, err
+	}
 
-		json.NewEncoder(w).Encode(&AnalyticsResponse{
-			TopPages:       topPages,
-			DeviceStats:    deviceStats,
-			PageViews:      pageViews,
-			TopReferrers:   topReferrers,
-			UniqueVisitors: uniqueVisitors,
-			VisitorGraph:   visitorGraph,
-		})
-	})
+	return org, nil
+}
 
-	return r
+// isUniqueViolation reports whether err comes from a unique constraint,
+// such as a site URL already used in the organization.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505", ConstraintName: "unique_organization_site_url"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("update site: %w", &pgconn.PgError{Code: "23505"}), want: true},
+		{name: "foreign key violation", err: &pgconn.PgError{Code: "23503"}, want: false},
+		{name: "no rows", err: pgx.ErrNoRows, want: false},
+		{name: "other error", err: errors.New("connection reset"), want: false},
+		{name: "no error", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err); got != tt.want {
+			t.Errorf("%s: isUniqueViolation(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
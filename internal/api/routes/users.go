@@ -3,17 +3,30 @@ package routes
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/ThEditor/clutter-studio/internal/api/common"
 	"github.com/ThEditor/clutter-studio/internal/api/middlewares"
+	"github.com/ThEditor/clutter-studio/internal/repository"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IpAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
 func UsersRouter(s *common.Server) http.Handler {
 	r := chi.NewRouter()
 
 	// endpoint for basic user info
-	r.With(middlewares.AuthWithoutEmailVerifiedMiddleware).
+	r.With(middlewares.AuthWithoutEmailVerifiedMiddleware(s)).
 		Get("/me", func(w http.ResponseWriter, r *http.Request) {
 			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
 			if !ok {
@@ -37,9 +50,77 @@ func UsersRouter(s *common.Server) http.Handler {
 			})
 		})
 
+	r.With(middlewares.AuthWithoutEmailVerifiedMiddleware(s)).
+		Get("/me/sessions", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			sessions, err := s.Repo.ListActiveSessionsByUserID(s.Ctx, claims.UserID)
+			if err != nil {
+				http.Error(w, "Couldn't fetch list of sessions", http.StatusInternalServerError)
+				return
+			}
+
+			res := make([]SessionResponse, 0, len(sessions))
+			for _, session := range sessions {
+				res = append(res, SessionResponse{
+					ID:         session.ID,
+					UserAgent:  session.UserAgent,
+					IpAddress:  session.IpAddress,
+					Current:    session.ID == claims.SessionID,
+					CreatedAt:  session.CreatedAt,
+					LastUsedAt: session.LastUsedAt,
+					ExpiresAt:  session.ExpiresAt,
+				})
+			}
+
+			json.NewEncoder(w).Encode(res)
+		})
+
+	r.With(middlewares.AuthWithoutEmailVerifiedMiddleware(s)).
+		Delete("/me/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(middlewares.ClaimsKey).(*common.Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			sessionId, err := uuid.Parse(chi.URLParam(r, "id"))
+			if err != nil {
+				http.Error(w, "Invalid UUID", http.StatusBadRequest)
+				return
+			}
+
+			revoked, err := s.Repo.RevokeUserSession(s.Ctx, repository.RevokeUserSessionParams{
+				ID:     sessionId,
+				UserID: claims.UserID,
+			})
+			if err != nil {
+				http.Error(w, "Could not revoke session", http.StatusInternalServerError)
+				return
+			}
+
+			if revoked == 0 {
+				http.Error(w, "Couldn't find session", http.StatusNotFound)
+				return
+			}
+
+			if sessionId == claims.SessionID {
+				common.DetachJWTCookie(w)
+				common.DetachRefreshCookie(w)
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": "Session successfully revoked!",
+			})
+		})
+
 	r.Group(func(r chi.Router) {
-		r.Use(middlewares.AuthMiddleware)
-		// other endpoints
+		r.Use(middlewares.AuthMiddleware(s))
+		r.Mount("/me/api-keys", APIKeysRouter(s))
 	})
 
 	return r
@@ -16,11 +16,13 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func Start(ctx context.Context, address string, port int, repo *repository.Queries, clickhouse *storage.ClickHouseStorage, mailer *mailer.Mailer) {
+func Start(ctx context.Context, address string, port int, db *pgxpool.Pool, repo *repository.Queries, clickhouse *storage.ClickHouseStorage, mailer *mailer.Mailer) {
 	s := &common.Server{
 		Ctx:        ctx,
+		DB:         db,
 		Repo:       repo,
 		ClickHouse: clickhouse,
 		Mailer:     mailer,
@@ -30,7 +32,7 @@ func Start(ctx context.Context, address string, port int, repo *repository.Queri
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:6789", "http://127.0.0.1:6789", "https://clutter.phy0.in"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Share-Password"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -44,6 +46,10 @@ func Start(ctx context.Context, address string, port int, repo *repository.Queri
 	r.Mount("/auth", routes.AuthRouter(s))
 	r.Mount("/users", routes.UsersRouter(s))
 	r.Mount("/sites", routes.SitesRouter(s))
+	r.Mount("/organizations", routes.OrganizationsRouter(s))
+	r.Mount("/invitations", routes.InvitationsRouter(s))
+	r.Mount("/shared", routes.SharedRouter(s))
+	r.Mount("/collector", routes.CollectorRouter(s))
 
 	log.Info("API server listening on " + address + ":" + strconv.Itoa(port))
 	err := http.ListenAndServe(address+":"+strconv.Itoa(port), r)
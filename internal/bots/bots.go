@@ -0,0 +1,169 @@
+// Package bots tells crawlers, headless browsers and other automated clients
+// apart from human visitors by their User-Agent header and IP address.
+package bots
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Reasons a visitor is classified as a bot.
+const (
+	ReasonEmptyUserAgent = "empty_user_agent"
+	ReasonCrawler        = "crawler"
+	ReasonHeadless       = "headless"
+	ReasonIPRange        = "ip_range"
+)
+
+// crawlerSignatures match the lowercased User-Agent of known crawlers, link
+// previewers, monitoring services and HTTP libraries.
+var crawlerSignatures = []string{
+	`bot\b`, `bot/`, `crawl`, `spider`, `slurp`, `archiver`, `facebookexternalhit`, `embedly`, `preview`,
+	`lighthouse`, `pingdom`, `uptime`, `python-requests`, `python-urllib`, `aiohttp`, `go-http-client`,
+	`curl/`, `wget/`, `okhttp`, `java/`, `libwww`, `httpclient`, `axios`, `node-fetch`, `scrapy`,
+}
+
+// headlessSignatures match the markers browsers send when driven by
+// automation tools.
+var headlessSignatures = []string{
+	`headless`, `phantomjs`, `puppeteer`, `playwright`, `selenium`, `webdriver`, `cypress`,
+}
+
+var (
+	crawlerPattern  = regexp.MustCompile(strings.Join(crawlerSignatures, "|"))
+	headlessPattern = regexp.MustCompile(strings.Join(headlessSignatures, "|"))
+)
+
+// Signatures returns the regular expressions matching the lowercased
+// User-Agent of bots, for evaluating ClassifyUserAgent in a database.
+func Signatures() []string {
+	return append(append([]string{}, headlessSignatures...), crawlerSignatures...)
+}
+
+var (
+	mu     sync.RWMutex
+	ranges []netip.Prefix
+)
+
+// LoadFile replaces the bot IP ranges with the ones in the file at path,
+// which lists one CIDR range or address per line. Blank lines and lines
+// starting with # are ignored.
+func LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read bot IP ranges: %w", err)
+	}
+	defer file.Close()
+
+	parsed := make([]netip.Prefix, 0)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		prefix, err := parseRange(text)
+		if err != nil {
+			return fmt.Errorf("invalid bot IP range on line %d: %w", line, err)
+		}
+		parsed = append(parsed, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read bot IP ranges: %w", err)
+	}
+
+	mu.Lock()
+	ranges = parsed
+	mu.Unlock()
+	return nil
+}
+
+func parseRange(text string) (netip.Prefix, error) {
+	if strings.Contains(text, "/") {
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		// IPv4-mapped ranges count their bits from the start of ::ffff:0:0/96
+		bits := prefix.Bits()
+		if prefix.Addr().Is4In6() {
+			if bits < 96 {
+				return netip.Prefix{}, fmt.Errorf("IPv4-mapped range %s is wider than ::ffff:0:0/96", text)
+			}
+			bits -= 96
+		}
+		return netip.PrefixFrom(prefix.Addr().Unmap(), bits).Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(text)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// IPRanges returns the loaded bot IP ranges in CIDR notation.
+func IPRanges() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	res := make([]string, 0, len(ranges))
+	for _, prefix := range ranges {
+		res = append(res, prefix.String())
+	}
+	return res
+}
+
+// ClassifyUserAgent returns the reason the User-Agent belongs to a bot, or
+// an empty string for browsers.
+func ClassifyUserAgent(ua string) string {
+	switch {
+	case strings.TrimSpace(ua) == "":
+		return ReasonEmptyUserAgent
+	}
+
+	ua = strings.ToLower(ua)
+	switch {
+	case headlessPattern.MatchString(ua):
+		return ReasonHeadless
+	case crawlerPattern.MatchString(ua):
+		return ReasonCrawler
+	}
+	return ""
+}
+
+// ClassifyIP returns ReasonIPRange if ip lies within one of the loaded bot
+// IP ranges, or an empty string otherwise.
+func ClassifyIP(ip string) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, prefix := range ranges {
+		if prefix.Contains(addr) {
+			return ReasonIPRange
+		}
+	}
+	return ""
+}
+
+// Classify returns the reason a visitor is a bot, or an empty string for
+// human visitors. User-Agent signatures take precedence over IP ranges.
+func Classify(ua string, ip string) string {
+	if reason := ClassifyUserAgent(ua); reason != "" {
+		return reason
+	}
+	return ClassifyIP(ip)
+}
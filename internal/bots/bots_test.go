@@ -0,0 +1,147 @@
+package bots
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want string
+	}{
+		{name: "empty", ua: "", want: ReasonEmptyUserAgent},
+		{name: "blank", ua: " \t", want: ReasonEmptyUserAgent},
+		{name: "googlebot", ua: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", want: ReasonCrawler},
+		{name: "bingbot", ua: "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", want: ReasonCrawler},
+		{name: "bot at end", ua: "SomeMonitorBot", want: ReasonCrawler},
+		{name: "spider", ua: "Baiduspider+(+http://www.baidu.com/search/spider.htm)", want: ReasonCrawler},
+		{name: "link preview", ua: "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", want: ReasonCrawler},
+		{name: "curl", ua: "curl/8.4.0", want: ReasonCrawler},
+		{name: "python requests", ua: "python-requests/2.31.0", want: ReasonCrawler},
+		{name: "go client", ua: "Go-http-client/1.1", want: ReasonCrawler},
+		{name: "headless chrome", ua: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", want: ReasonHeadless},
+		{name: "headless before crawler", ua: "Puppeteer crawler", want: ReasonHeadless},
+		{name: "phantomjs", ua: "Mozilla/5.0 (Unknown; Linux x86_64) AppleWebKit/538.1 (KHTML, like Gecko) PhantomJS/2.1.1 Safari/538.1", want: ReasonHeadless},
+		{name: "chrome", ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", want: ""},
+		{name: "iphone safari", ua: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", want: ""},
+		{name: "firefox", ua: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", want: ""},
+		{name: "bot inside a word", ua: "Mozilla/5.0 (Linux; Android 13; Robotic Arm) Chrome/120.0.0.0 Mobile Safari/537.36", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyUserAgent(tt.ua); got != tt.want {
+				t.Errorf("ClassifyUserAgent(%q) = %q, want %q", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
+
+// loadRanges loads the given file contents as the bot IP ranges for the
+// duration of the test.
+func loadRanges(t *testing.T, contents string) error {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ranges.txt")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		mu.Lock()
+		ranges = nil
+		mu.Unlock()
+	})
+	return LoadFile(path)
+}
+
+func TestClassifyIP(t *testing.T) {
+	err := loadRanges(t, "# crawlers\n66.249.64.0/19\n\n  203.0.113.7  \n2001:4860:4801::/48\n::ffff:198.51.100.0/120\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "66.249.64.1", want: ReasonIPRange},
+		{ip: "66.249.95.255", want: ReasonIPRange},
+		{ip: "66.249.96.0", want: ""},
+		{ip: "203.0.113.7", want: ReasonIPRange},
+		{ip: "203.0.113.8", want: ""},
+		{ip: "::ffff:66.249.64.1", want: ReasonIPRange},
+		{ip: "198.51.100.42", want: ReasonIPRange},
+		{ip: "2001:4860:4801:10::1", want: ReasonIPRange},
+		{ip: "2001:4860:4802::1", want: ""},
+		{ip: " 66.249.64.1 ", want: ReasonIPRange},
+		{ip: "", want: ""},
+		{ip: "not an ip", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyIP(tt.ip); got != tt.want {
+			t.Errorf("ClassifyIP(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	want := []string{"66.249.64.0/19", "203.0.113.7/32", "2001:4860:4801::/48", "198.51.100.0/24"}
+	if got := IPRanges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IPRanges() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{name: "bad address", contents: "66.249.64.0/19\n300.1.1.1\n"},
+		{name: "bad prefix length", contents: "66.249.64.0/33\n"},
+		{name: "hostname", contents: "crawler.example.com\n"},
+		{name: "mapped range wider than ipv4", contents: "::ffff:0:0/80\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := loadRanges(t, tt.contents); err == nil {
+				t.Error("LoadFile() succeeded, want an error")
+			}
+		})
+	}
+
+	if err := LoadFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadFile() of a missing file succeeded, want an error")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	if err := loadRanges(t, "66.249.64.0/19\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	tests := []struct {
+		name string
+		ua   string
+		ip   string
+		want string
+	}{
+		{name: "human", ua: chrome, ip: "192.0.2.1", want: ""},
+		{name: "bot address", ua: chrome, ip: "66.249.64.1", want: ReasonIPRange},
+		{name: "user agent wins", ua: "curl/8.4.0", ip: "66.249.64.1", want: ReasonCrawler},
+		{name: "empty user agent", ua: "", ip: "192.0.2.1", want: ReasonEmptyUserAgent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.ua, tt.ip); got != tt.want {
+				t.Errorf("Classify(%q, %q) = %q, want %q", tt.ua, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
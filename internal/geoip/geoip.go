@@ -0,0 +1,216 @@
+// Package geoip resolves IP addresses to locations from a local MaxMind DB
+// (.mmdb) or CSV range file. It never performs network lookups.
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/log"
+)
+
+const Unknown = "Unknown"
+
+type Location struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+}
+
+type database interface {
+	lookup(addr netip.Addr) (Location, bool)
+}
+
+// Resolver looks up locations in the database file at its path, picking up
+// replacements of the file while watched.
+type Resolver struct {
+	path string
+
+	mu      sync.RWMutex
+	db      database
+	modTime time.Time
+	size    int64
+}
+
+// Open loads the database at path. Files ending in .csv are read as rows of
+// start IP, end IP, country code, region and city; anything else as MMDB.
+func Open(path string) (*Resolver, error) {
+	r := &Resolver{path: path}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Lookup returns the location of ip, with Unknown for every part the database
+// does not know. A nil Resolver knows nothing.
+func (r *Resolver) Lookup(ip string) Location {
+	unknown := Location{Country: Unknown, Region: Unknown, City: Unknown}
+	if r == nil {
+		return unknown
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return unknown
+	}
+
+	r.mu.RLock()
+	db := r.db
+	r.mu.RUnlock()
+
+	location, ok := db.lookup(addr.Unmap())
+	if !ok {
+		return unknown
+	}
+
+	if location.Country == "" {
+		location.Country = Unknown
+	}
+	if location.Region == "" {
+		location.Region = Unknown
+	}
+	if location.City == "" {
+		location.City = Unknown
+	}
+	return location
+}
+
+// Watch reloads the database whenever the file's size or modification time
+// changes, checking every interval until ctx is done. A file that fails to
+// load keeps the previous database in use.
+func (r *Resolver) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(r.path)
+			if err != nil {
+				log.Warn("GeoIP database unavailable: " + err.Error())
+				continue
+			}
+
+			r.mu.RLock()
+			changed := !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := r.reload(); err != nil {
+				log.Warn("Couldn't reload GeoIP database: " + err.Error())
+				continue
+			}
+			log.Info("Reloaded GeoIP database from " + r.path)
+		}
+	}
+}
+
+func (r *Resolver) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+
+	var db database
+	if strings.EqualFold(filepath.Ext(r.path), ".csv") {
+		db, err = parseCSV(data)
+	} else {
+		db, err = parseMMDB(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load GeoIP database: %w", err)
+	}
+
+	r.mu.Lock()
+	r.db = db
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	r.mu.Unlock()
+	return nil
+}
+
+type ipRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location Location
+}
+
+// csvDatabase holds non-overlapping ranges sorted by start address.
+type csvDatabase []ipRange
+
+func parseCSV(data []byte) (csvDatabase, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var db csvDatabase
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least start IP, end IP and country", line)
+		}
+
+		start, err := netip.ParseAddr(record[0])
+		if err != nil {
+			// a header row
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		end, err := netip.ParseAddr(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		r := ipRange{start: start.Unmap(), end: end.Unmap(), location: Location{Country: record[2]}}
+		if len(record) > 3 {
+			r.location.Region = record[3]
+		}
+		if len(record) > 4 {
+			r.location.City = record[4]
+		}
+		db = append(db, r)
+	}
+
+	sort.Slice(db, func(i, j int) bool { return db[i].start.Less(db[j].start) })
+	return db, nil
+}
+
+func (db csvDatabase) lookup(addr netip.Addr) (Location, bool) {
+	// the last range starting at or before addr
+	i := sort.Search(len(db), func(i int) bool { return addr.Less(db[i].start) }) - 1
+	if i < 0 || db[i].end.Less(addr) || db[i].start.BitLen() != addr.BitLen() {
+		return Location{}, false
+	}
+	return db[i].location, true
+}
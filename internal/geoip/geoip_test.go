@@ -0,0 +1,280 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureRecord is a network of the test database and its data record.
+type fixtureRecord struct {
+	prefix string
+	data   []byte
+}
+
+// mmdbNode holds the two records of a search tree node: a child node index,
+// or -1 for no data, or -2-offset for the data section offset.
+type mmdbNode [2]int
+
+// buildMMDB writes an IPv6 MaxMind DB with the given record size, placing
+// IPv4 networks under ::/96 as real databases do.
+func buildMMDB(t *testing.T, recordSize int, records []fixtureRecord) []byte {
+	t.Helper()
+
+	nodes := []mmdbNode{{-1, -1}}
+	var data []byte
+
+	for _, record := range records {
+		prefix := netip.MustParsePrefix(record.prefix)
+		bits := prefix.Addr().As16()
+		length := prefix.Bits()
+		if prefix.Addr().Is4() {
+			bits = [16]byte{}
+			v4 := prefix.Addr().As4()
+			copy(bits[12:], v4[:])
+			length += 96
+		}
+
+		offset := len(data)
+		data = append(data, record.data...)
+
+		node := 0
+		for i := 0; i < length; i++ {
+			bit := int(bits[i/8]>>(7-i%8)) & 1
+			if i == length-1 {
+				nodes[node][bit] = -2 - offset
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, mmdbNode{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	nodeCount := len(nodes)
+	resolve := func(value int) uint32 {
+		switch {
+		case value == -1:
+			return uint32(nodeCount)
+		case value < -1:
+			return uint32(nodeCount + 16 + (-2 - value))
+		default:
+			return uint32(value)
+		}
+	}
+
+	var file []byte
+	for _, node := range nodes {
+		left, right := resolve(node[0]), resolve(node[1])
+		switch recordSize {
+		case 24:
+			file = append(file, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			file = append(file, byte(left>>16), byte(left>>8), byte(left), byte(left>>24)<<4|byte(right>>24)&0x0f, byte(right>>16), byte(right>>8), byte(right))
+		default:
+			file = binary.BigEndian.AppendUint32(file, left)
+			file = binary.BigEndian.AppendUint32(file, right)
+		}
+	}
+
+	file = append(file, make([]byte, 16)...)
+	file = append(file, data...)
+	file = append(file, metadataMarker...)
+	file = append(file, mmdbMap(
+		mmdbString("node_count"), mmdbUint32(uint32(nodeCount)),
+		mmdbString("record_size"), mmdbUint16(uint16(recordSize)),
+		mmdbString("ip_version"), mmdbUint16(6),
+		mmdbString("database_type"), mmdbString("Test-City"),
+	)...)
+	return file
+}
+
+func mmdbString(s string) []byte {
+	return append([]byte{typeString<<5 | byte(len(s))}, s...)
+}
+
+func mmdbUint16(n uint16) []byte {
+	return binary.BigEndian.AppendUint16([]byte{typeUint16<<5 | 2}, n)
+}
+
+func mmdbUint32(n uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{typeUint32<<5 | 4}, n)
+}
+
+// mmdbPointer points at offset in the data section, which must fit 11 bits.
+func mmdbPointer(offset int) []byte {
+	return []byte{typePointer<<5 | byte(offset>>8)&0x7, byte(offset)}
+}
+
+func mmdbMap(pairs ...[]byte) []byte {
+	res := []byte{typeMap<<5 | byte(len(pairs)/2)}
+	for _, pair := range pairs {
+		res = append(res, pair...)
+	}
+	return res
+}
+
+func mmdbArray(values ...[]byte) []byte {
+	res := []byte{typeExtended<<5 | byte(len(values)), typeArray - 7}
+	for _, value := range values {
+		res = append(res, value...)
+	}
+	return res
+}
+
+func names(name string) []byte {
+	return mmdbMap(mmdbString("names"), mmdbMap(mmdbString("en"), mmdbString(name)))
+}
+
+func writeFixture(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMMDBLookup(t *testing.T) {
+	mountainView := mmdbMap(
+		mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("US")),
+		mmdbString("subdivisions"), mmdbArray(names("California")),
+		mmdbString("city"), names("Mountain View"),
+	)
+	records := []fixtureRecord{
+		{prefix: "1.2.3.0/24", data: mountainView},
+		{prefix: "81.2.69.0/24", data: mmdbMap(mmdbString("registered_country"), mmdbMap(mmdbString("iso_code"), mmdbString("GB")))},
+		{prefix: "2001:db8::/32", data: mmdbMap(
+			mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("DE")),
+			mmdbString("subdivisions"), mmdbArray(names("Berlin"), names("Mitte")),
+			mmdbString("city"), names("Berlin"),
+		)},
+	}
+
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{ip: "1.2.3.4", want: Location{Country: "US", Region: "California", City: "Mountain View"}},
+		{ip: "1.2.3.255", want: Location{Country: "US", Region: "California", City: "Mountain View"}},
+		{ip: "::ffff:1.2.3.4", want: Location{Country: "US", Region: "California", City: "Mountain View"}},
+		{ip: " 1.2.3.4 ", want: Location{Country: "US", Region: "California", City: "Mountain View"}},
+		{ip: "81.2.69.160", want: Location{Country: "GB", Region: Unknown, City: Unknown}},
+		{ip: "2001:db8:1::1", want: Location{Country: "DE", Region: "Berlin", City: "Berlin"}},
+		{ip: "1.2.4.1", want: Location{Country: Unknown, Region: Unknown, City: Unknown}},
+		{ip: "2001:db9::1", want: Location{Country: Unknown, Region: Unknown, City: Unknown}},
+		{ip: "not an ip", want: Location{Country: Unknown, Region: Unknown, City: Unknown}},
+		{ip: "", want: Location{Country: Unknown, Region: Unknown, City: Unknown}},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		resolver, err := Open(writeFixture(t, "test.mmdb", buildMMDB(t, recordSize, records)))
+		if err != nil {
+			t.Fatalf("record size %d: Open() error = %v", recordSize, err)
+		}
+
+		for _, tt := range tests {
+			if got := resolver.Lookup(tt.ip); got != tt.want {
+				t.Errorf("record size %d: Lookup(%q) = %+v, want %+v", recordSize, tt.ip, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestMMDBPointer(t *testing.T) {
+	// the second record's map reuses the first record's key and value
+	first := mmdbMap(mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("FR")))
+	second := append([]byte{typeMap<<5 | 1}, append(mmdbPointer(1), mmdbPointer(1+len(mmdbString("country")))...)...)
+
+	resolver, err := Open(writeFixture(t, "test.mmdb", buildMMDB(t, 24, []fixtureRecord{
+		{prefix: "10.0.0.0/8", data: first},
+		{prefix: "11.0.0.0/8", data: second},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ip := range []string{"10.1.2.3", "11.1.2.3"} {
+		if got := resolver.Lookup(ip).Country; got != "FR" {
+			t.Errorf("Lookup(%q).Country = %q, want FR", ip, got)
+		}
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data []byte
+	}{
+		{name: "missing metadata", file: "test.mmdb", data: []byte("not a database")},
+		{name: "unsupported record size", file: "test.mmdb", data: append(append(make([]byte, 32), metadataMarker...), mmdbMap(
+			mmdbString("node_count"), mmdbUint32(1),
+			mmdbString("record_size"), mmdbUint16(20),
+			mmdbString("ip_version"), mmdbUint16(6),
+		)...)},
+		{name: "truncated tree", file: "test.mmdb", data: append(append([]byte{}, metadataMarker...), mmdbMap(
+			mmdbString("node_count"), mmdbUint32(1000),
+			mmdbString("record_size"), mmdbUint16(24),
+			mmdbString("ip_version"), mmdbUint16(6),
+		)...)},
+		{name: "csv with bad address", file: "test.csv", data: []byte("1.0.0.0,1.0.0.255,AU\n1.0.1.0,nope,CN\n")},
+		{name: "csv with missing country", file: "test.csv", data: []byte("1.0.0.0,1.0.0.255\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(writeFixture(t, tt.file, tt.data)); err == nil {
+				t.Error("Open() succeeded, want an error")
+			}
+		})
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("Open() of a missing file succeeded, want an error")
+	}
+}
+
+func TestCSVLookup(t *testing.T) {
+	resolver, err := Open(writeFixture(t, "test.csv", []byte(
+		"start_ip,end_ip,country,region,city\n"+
+			"5.0.0.0,5.0.0.255,NL,North Holland,Amsterdam\n"+
+			"1.0.0.0,1.0.0.255,AU\n"+
+			"2001:db8::,2001:db8::ffff,JP,Tokyo,\n",
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{ip: "1.0.0.0", want: Location{Country: "AU", Region: Unknown, City: Unknown}},
+		{ip: "1.0.0.255", want: Location{Country: "AU", Region: Unknown, City: Unknown}},
+		{ip: "1.0.1.0", want: Location{Country: Unknown, Region: Unknown, City: Unknown}},
+		{ip: "5.0.0.42", want: Location{Country: "NL", Region: "North Holland", City: "Amsterdam"}},
+		{ip: "::ffff:5.0.0.42", want: Location{Country: "NL", Region: "North Holland", City: "Amsterdam"}},
+		{ip: "0.255.255.255", want: Location{Country: Unknown, Region: Unknown, City: Unknown}},
+		{ip: "2001:db8::1", want: Location{Country: "JP", Region: "Tokyo", City: Unknown}},
+		{ip: "2001:db8::1:0", want: Location{Country: Unknown, Region: Unknown, City: Unknown}},
+	}
+
+	for _, tt := range tests {
+		if got := resolver.Lookup(tt.ip); got != tt.want {
+			t.Errorf("Lookup(%q) = %+v, want %+v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestNilResolver(t *testing.T) {
+	var resolver *Resolver
+	want := Location{Country: Unknown, Region: Unknown, City: Unknown}
+	if got := resolver.Lookup("1.2.3.4"); got != want {
+		t.Errorf("Lookup() = %+v, want %+v", got, want)
+	}
+}
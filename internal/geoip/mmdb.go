@@ -0,0 +1,331 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// metadataMarker precedes the metadata map at the end of an MMDB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdb is a MaxMind DB file read fully into memory. Only the subset of the
+// format needed for location lookups is implemented.
+type mmdb struct {
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dataStart  uint
+	ipv4Start  uint
+}
+
+func parseMMDB(data []byte) (*mmdb, error) {
+	markerAt := bytes.LastIndex(data, metadataMarker)
+	if markerAt < 0 {
+		return nil, errors.New("missing MMDB metadata")
+	}
+
+	meta, _, err := (&decoder{data: data[markerAt+len(metadataMarker):]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MMDB metadata: %w", err)
+	}
+
+	fields, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid MMDB metadata")
+	}
+
+	db := &mmdb{
+		data:       data,
+		nodeCount:  uint(asUint(fields["node_count"])),
+		recordSize: uint(asUint(fields["record_size"])),
+		ipVersion:  uint(asUint(fields["ip_version"])),
+	}
+
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported MMDB record size %d", db.recordSize)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	db.dataStart = treeSize + 16
+	if db.dataStart > uint(markerAt) {
+		return nil, errors.New("truncated MMDB search tree")
+	}
+
+	// IPv4 addresses live under ::/96 of an IPv6 tree
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+
+	return db, nil
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a node.
+func (db *mmdb) record(node uint, bit uint) uint {
+	size := db.recordSize / 4
+	b := db.data[node*size : (node+1)*size]
+
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+func (db *mmdb) lookup(addr netip.Addr) (Location, bool) {
+	node := uint(0)
+	bits := addr.AsSlice()
+	if addr.Is4() {
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return Location{}, false
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+
+	if node < db.nodeCount+16 {
+		return Location{}, false
+	}
+
+	offset := node - db.nodeCount - 16
+	d := &decoder{data: db.data[db.dataStart:]}
+	value, _, err := d.decode(offset)
+	if err != nil {
+		return Location{}, false
+	}
+
+	record, ok := value.(map[string]any)
+	if !ok {
+		return Location{}, false
+	}
+
+	location := Location{
+		Country: asString(lookupPath(record, "country", "iso_code")),
+		City:    asString(lookupPath(record, "city", "names", "en")),
+	}
+	if location.Country == "" {
+		location.Country = asString(lookupPath(record, "registered_country", "iso_code"))
+	}
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		location.Region = asString(lookupPath(subdivisions[0], "names", "en"))
+	}
+
+	return location, true
+}
+
+// decoder reads values of the MMDB data section format.
+type decoder struct {
+	data []byte
+}
+
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+var errTruncated = errors.New("truncated MMDB data")
+
+// decode returns the value at offset and the offset right after it.
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	if offset >= uint(len(d.data)) {
+		return nil, 0, errTruncated
+	}
+
+	ctrl := d.data[offset]
+	offset++
+
+	kind := uint(ctrl >> 5)
+	if kind == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+
+	if kind == typeExtended {
+		if offset >= uint(len(d.data)) {
+			return nil, 0, errTruncated
+		}
+		kind = 7 + uint(d.data[offset])
+		offset++
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[asString(key)] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, errTruncated
+	}
+	b := d.data[offset : offset+size]
+	next := offset + size
+
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return b, next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid MMDB double")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid MMDB float")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128, typeInt32:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if kind == typeInt32 {
+			return int64(int32(n)), next, nil
+		}
+		return n, next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported MMDB data type %d", kind)
+	}
+}
+
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl>>3)&0x3 + 1
+	if offset+size > uint(len(d.data)) {
+		return 0, 0, errTruncated
+	}
+
+	b := d.data[offset : offset+size]
+	var pointer uint
+	if size != 4 {
+		pointer = uint(ctrl & 0x7)
+	}
+	for _, c := range b {
+		pointer = pointer<<8 | uint(c)
+	}
+
+	switch size {
+	case 2:
+		pointer += 2048
+	case 3:
+		pointer += 526336
+	}
+
+	return pointer, offset + size, nil
+}
+
+func (d *decoder) size(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > uint(len(d.data)) {
+		return 0, 0, errTruncated
+	}
+
+	var n uint
+	for _, c := range d.data[offset : offset+extra] {
+		n = n<<8 | uint(c)
+	}
+
+	switch size {
+	case 29:
+		n += 29
+	case 30:
+		n += 285
+	default:
+		n += 65821
+	}
+
+	return n, offset + extra, nil
+}
+
+// lookupPath walks nested maps along keys.
+func lookupPath(value any, keys ...string) any {
+	for _, key := range keys {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+func asString(value any) string {
+	s, _ := value.(string)
+	return s
+}
+
+func asUint(value any) uint64 {
+	n, _ := value.(uint64)
+	return n
+}
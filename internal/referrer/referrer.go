@@ -0,0 +1,150 @@
+// Package referrer normalizes referrer hosts to named sources and groups
+// them into channels.
+package referrer
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	ChannelDirect        = "Direct"
+	ChannelOrganicSearch = "Organic Search"
+	ChannelSocial        = "Social"
+	ChannelEmail         = "Email"
+	ChannelReferral      = "Referral"
+)
+
+var channels = []string{ChannelDirect, ChannelOrganicSearch, ChannelSocial, ChannelEmail, ChannelReferral}
+
+type Source struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel"`
+}
+
+// direct is the source of visits without a referrer or coming from the
+// site itself.
+var direct = Source{Name: ChannelDirect, Channel: ChannelDirect}
+
+// sourcesJSON maps source names to their channel and domains. A domain
+// ending in ".*" matches that label under any suffix, e.g. "google.*"
+// matches google.de and google.co.uk.
+//
+//go:embed sources.json
+var sourcesJSON []byte
+
+type sourceDefinition struct {
+	Channel string   `json:"channel"`
+	Domains []string `json:"domains"`
+}
+
+var (
+	mu      sync.RWMutex
+	domains map[string]Source
+)
+
+func init() {
+	parsed, err := parseSources(sourcesJSON)
+	if err != nil {
+		panic(err)
+	}
+	domains = parsed
+}
+
+// LoadFile replaces the embedded source mapping with the one in the JSON
+// file at path, which has the same format as sources.json.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read referrer sources: %w", err)
+	}
+
+	parsed, err := parseSources(data)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	domains = parsed
+	mu.Unlock()
+	return nil
+}
+
+func parseSources(data []byte) (map[string]Source, error) {
+	var definitions map[string]sourceDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("invalid referrer sources: %w", err)
+	}
+
+	parsed := make(map[string]Source)
+	for name, definition := range definitions {
+		if !isChannel(definition.Channel) {
+			return nil, fmt.Errorf("unknown channel %q for referrer source %q", definition.Channel, name)
+		}
+		for _, domain := range definition.Domains {
+			parsed[strings.ToLower(domain)] = Source{Name: name, Channel: definition.Channel}
+		}
+	}
+	return parsed, nil
+}
+
+func isChannel(channel string) bool {
+	for _, c := range channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify returns the source of a referrer host. Empty hosts and hosts
+// belonging to one of the site's own domains are Direct, unknown hosts are
+// Referrals named after the host.
+func Classify(host string, siteDomains []string) Source {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" || IsSelfReferral(host, siteDomains) {
+		return direct
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	// the host itself, then each parent domain
+	for candidate := host; candidate != ""; {
+		if source, ok := domains[candidate]; ok {
+			return source
+		}
+		_, parent, found := strings.Cut(candidate, ".")
+		if !found || !strings.Contains(parent, ".") {
+			break
+		}
+		candidate = parent
+	}
+
+	// wildcard entries such as google.*
+	labels := strings.Split(host, ".")
+	for _, label := range labels[:len(labels)-1] {
+		if source, ok := domains[label+".*"]; ok {
+			return source
+		}
+	}
+
+	return Source{Name: strings.TrimPrefix(host, "www."), Channel: ChannelReferral}
+}
+
+// IsSelfReferral reports whether host is one of the site's domains or a
+// subdomain of one.
+func IsSelfReferral(host string, siteDomains []string) bool {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	for _, domain := range siteDomains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
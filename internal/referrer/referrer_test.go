@@ -0,0 +1,88 @@
+package referrer
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	siteDomains := []string{"mysite.com", "www.docs.example"}
+
+	tests := []struct {
+		name string
+		host string
+		want Source
+	}{
+		{name: "no referrer", host: "", want: direct},
+		{name: "blank referrer", host: "  ", want: direct},
+		{name: "site itself", host: "mysite.com", want: direct},
+		{name: "site with www", host: "www.mysite.com", want: direct},
+		{name: "site subdomain", host: "blog.mysite.com", want: direct},
+		{name: "site alias without www", host: "docs.example", want: direct},
+		{name: "site with trailing dot", host: "MySite.com.", want: direct},
+		{name: "exact domain", host: "duckduckgo.com", want: Source{Name: "DuckDuckGo", Channel: ChannelOrganicSearch}},
+		{name: "case and whitespace", host: " Bing.COM ", want: Source{Name: "Bing", Channel: ChannelOrganicSearch}},
+		{name: "parent domain", host: "en.wikipedia.org", want: Source{Name: "Wikipedia", Channel: ChannelReferral}},
+		{name: "wildcard", host: "google.co.uk", want: Source{Name: "Google", Channel: ChannelOrganicSearch}},
+		{name: "wildcard with subdomain", host: "www.google.com", want: Source{Name: "Google", Channel: ChannelOrganicSearch}},
+		{name: "exact before wildcard", host: "mail.google.com", want: Source{Name: "Gmail", Channel: ChannelEmail}},
+		{name: "short domain", host: "t.co", want: Source{Name: "X (Twitter)", Channel: ChannelSocial}},
+		{name: "social", host: "l.facebook.com", want: Source{Name: "Facebook", Channel: ChannelSocial}},
+		{name: "unknown host", host: "www.example.org", want: Source{Name: "example.org", Channel: ChannelReferral}},
+		{name: "lookalike of site", host: "notmysite.com", want: Source{Name: "notmysite.com", Channel: ChannelReferral}},
+		{name: "single label", host: "localhost", want: Source{Name: "localhost", Channel: ChannelReferral}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.host, siteDomains); got != tt.want {
+				t.Errorf("Classify(%q) = %+v, want %+v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSelfReferral(t *testing.T) {
+	tests := []struct {
+		host        string
+		siteDomains []string
+		want        bool
+	}{
+		{host: "mysite.com", siteDomains: []string{"mysite.com"}, want: true},
+		{host: "WWW.MySite.com", siteDomains: []string{"mysite.com"}, want: true},
+		{host: "mysite.com", siteDomains: []string{"www.mysite.com"}, want: true},
+		{host: "a.b.mysite.com", siteDomains: []string{"mysite.com"}, want: true},
+		{host: "shop.example", siteDomains: []string{"mysite.com", "shop.example"}, want: true},
+		{host: "notmysite.com", siteDomains: []string{"mysite.com"}, want: false},
+		{host: "mysite.com.evil.example", siteDomains: []string{"mysite.com"}, want: false},
+		{host: "mysite.com", siteDomains: []string{""}, want: false},
+		{host: "mysite.com", siteDomains: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSelfReferral(tt.host, tt.siteDomains); got != tt.want {
+			t.Errorf("IsSelfReferral(%q, %q) = %v, want %v", tt.host, tt.siteDomains, got, tt.want)
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "valid", data: `{"Example": {"channel": "Social", "domains": ["Example.com"]}}`},
+		{name: "unknown channel", data: `{"Example": {"channel": "Paid", "domains": ["example.com"]}}`, wantErr: true},
+		{name: "invalid json", data: `{"Example":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseSources([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && parsed["example.com"] != (Source{Name: "Example", Channel: ChannelSocial}) {
+				t.Errorf("parseSources() = %+v, want example.com lowercased and mapped to Example", parsed)
+			}
+		})
+	}
+}
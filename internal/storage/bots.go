@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/ThEditor/clutter-studio/internal/bots"
+)
+
+type BotReasonStats struct {
+	Reason    string `json:"reason"`
+	Visitors  int    `json:"visitors"`
+	PageViews int    `json:"page_views"`
+}
+
+type BotUserAgentStats struct {
+	UserAgent string `json:"user_agent"`
+	Reason    string `json:"reason"`
+	Visitors  int    `json:"visitors"`
+	PageViews int    `json:"page_views"`
+}
+
+type BotTraffic struct {
+	Visitors   int                 `json:"visitors"`
+	PageViews  int                 `json:"page_views"`
+	Reasons    []BotReasonStats    `json:"reasons"`
+	UserAgents []BotUserAgentStats `json:"user_agents"`
+}
+
+// botCondition renders the condition matching the events of bots, the SQL
+// counterpart of bots.Classify.
+func botCondition() (string, []any) {
+	signatures := bots.Signatures()
+	conditions := []string{
+		"trimBoth(visitor_user_agent) = ''",
+		"multiMatchAny(lower(visitor_user_agent), [" + placeholders(len(signatures)) + "])",
+	}
+	args := make([]any, 0, len(signatures))
+	for _, signature := range signatures {
+		args = append(args, signature)
+	}
+
+	if prefixes := bots.IPRanges(); len(prefixes) > 0 {
+		condition, rangeArgs := ipRangesCondition(prefixes)
+		conditions = append(conditions, condition)
+		args = append(args, rangeArgs...)
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// ipRangesCondition renders the condition matching the events whose visitor
+// address lies in one of the CIDR prefixes. Rows whose visitor_ip is not a
+// bare address, such as a forwarded list or an address with a port, never
+// match rather than making isIPAddressInRange throw, and both sides are
+// compared in their IPv6 form so that IPv4-mapped addresses match IPv4 ranges
+// as they do in bots.ClassifyIP.
+func ipRangesCondition(prefixes []string) (string, []any) {
+	conditions := make([]string, 0, len(prefixes))
+	args := make([]any, 0, len(prefixes))
+	for _, text := range prefixes {
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			continue
+		}
+		if prefix.Addr().Is4() {
+			prefix = netip.PrefixFrom(netip.AddrFrom16(prefix.Addr().As16()), prefix.Bits()+96)
+		}
+		conditions = append(conditions, "isIPAddressInRange(IPv6NumToString(toIPv6(trimBoth(visitor_ip))), ?)")
+		args = append(args, prefix.String())
+	}
+	if len(conditions) == 0 {
+		return "0", nil
+	}
+
+	return "((isIPv4String(trimBoth(visitor_ip)) OR isIPv6String(trimBoth(visitor_ip))) AND (" + strings.Join(conditions, " OR ") + "))", args
+}
+
+// GetBotTraffic returns the pageviews excluded from the other reports as
+// bot traffic, broken down by the reason they were classified as bots and
+// by user agent.
+func (s *ClickHouseStorage) GetBotTraffic(q Query, limit int, offset int) (*BotTraffic, error) {
+	traffic := &BotTraffic{
+		Reasons:    make([]BotReasonStats, 0),
+		UserAgents: make([]BotUserAgentStats, 0),
+	}
+
+	bot, botArgs := botCondition()
+
+	q.IncludeBots = true
+	where, args := q.where()
+	rows, err := s.db.Query(`
+		SELECT visitor_user_agent, visitor_ip, count(*) AS page_views
+		FROM events
+		WHERE `+where+`
+		  AND `+bot+`
+		GROUP BY visitor_user_agent, visitor_ip
+	`, append(args, botArgs...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bot traffic: %w", err)
+	}
+	defer rows.Close()
+
+	reasons := make(map[string]*BotReasonStats)
+	userAgents := make(map[[2]string]*BotUserAgentStats)
+	for rows.Next() {
+		var ua, ip string
+		var pageViews int
+		if err := rows.Scan(&ua, &ip, &pageViews); err != nil {
+			return nil, fmt.Errorf("failed to scan bot traffic: %w", err)
+		}
+
+		reason := bots.Classify(ua, ip)
+		traffic.Visitors++
+		traffic.PageViews += pageViews
+
+		byReason, ok := reasons[reason]
+		if !ok {
+			byReason = &BotReasonStats{Reason: reason}
+			reasons[reason] = byReason
+		}
+		byReason.Visitors++
+		byReason.PageViews += pageViews
+
+		byUserAgent, ok := userAgents[[2]string{ua, reason}]
+		if !ok {
+			byUserAgent = &BotUserAgentStats{UserAgent: ua, Reason: reason}
+			userAgents[[2]string{ua, reason}] = byUserAgent
+		}
+		byUserAgent.Visitors++
+		byUserAgent.PageViews += pageViews
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over bot traffic: %w", err)
+	}
+
+	for _, stats := range reasons {
+		traffic.Reasons = append(traffic.Reasons, *stats)
+	}
+	sort.Slice(traffic.Reasons, func(i, j int) bool {
+		if traffic.Reasons[i].PageViews != traffic.Reasons[j].PageViews {
+			return traffic.Reasons[i].PageViews > traffic.Reasons[j].PageViews
+		}
+		return traffic.Reasons[i].Reason < traffic.Reasons[j].Reason
+	})
+
+	for _, stats := range userAgents {
+		traffic.UserAgents = append(traffic.UserAgents, *stats)
+	}
+	sort.Slice(traffic.UserAgents, func(i, j int) bool {
+		if traffic.UserAgents[i].PageViews != traffic.UserAgents[j].PageViews {
+			return traffic.UserAgents[i].PageViews > traffic.UserAgents[j].PageViews
+		}
+		if traffic.UserAgents[i].UserAgent != traffic.UserAgents[j].UserAgent {
+			return traffic.UserAgents[i].UserAgent < traffic.UserAgents[j].UserAgent
+		}
+		return traffic.UserAgents[i].Reason < traffic.UserAgents[j].Reason
+	})
+	traffic.UserAgents = paginate(traffic.UserAgents, limit, offset)
+
+	return traffic, nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ThEditor/clutter-studio/internal/bots"
+)
+
+const (
+	ipGuard   = "(isIPv4String(trimBoth(visitor_ip)) OR isIPv6String(trimBoth(visitor_ip)))"
+	ipInRange = "isIPAddressInRange(IPv6NumToString(toIPv6(trimBoth(visitor_ip))), ?)"
+)
+
+func TestIPRangesCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "ipv4 ranges are mapped",
+			prefixes: []string{"66.249.64.0/19", "203.0.113.7/32"},
+			wantSQL:  "(" + ipGuard + " AND (" + ipInRange + " OR " + ipInRange + "))",
+			wantArgs: []any{"::ffff:66.249.64.0/115", "::ffff:203.0.113.7/128"},
+		},
+		{
+			name:     "ipv6 ranges are kept",
+			prefixes: []string{"2001:4860:4801::/48"},
+			wantSQL:  "(" + ipGuard + " AND (" + ipInRange + "))",
+			wantArgs: []any{"2001:4860:4801::/48"},
+		},
+		{
+			name:     "whole ipv4 space",
+			prefixes: []string{"0.0.0.0/0"},
+			wantSQL:  "(" + ipGuard + " AND (" + ipInRange + "))",
+			wantArgs: []any{"::ffff:0.0.0.0/96"},
+		},
+		{
+			name:     "invalid ranges are skipped",
+			prefixes: []string{"10.0.0.0/33", "10.0.0.0/8"},
+			wantSQL:  "(" + ipGuard + " AND (" + ipInRange + "))",
+			wantArgs: []any{"::ffff:10.0.0.0/104"},
+		},
+		{name: "nothing to match", prefixes: nil, wantSQL: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := ipRangesCondition(tt.prefixes)
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %q, want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestBotCondition(t *testing.T) {
+	signatures := len(bots.Signatures())
+
+	sql, args := botCondition()
+	if strings.Contains(sql, "visitor_ip") {
+		t.Errorf("botCondition() without IP ranges = %q, want no visitor_ip condition", sql)
+	}
+	if len(args) != signatures {
+		t.Errorf("botCondition() has %d args, want %d", len(args), signatures)
+	}
+
+	path := filepath.Join(t.TempDir(), "ranges.txt")
+	if err := os.WriteFile(path, []byte("66.249.64.0/19\n::ffff:198.51.100.0/120\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := bots.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		empty := filepath.Join(t.TempDir(), "empty.txt")
+		if err := os.WriteFile(empty, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := bots.LoadFile(empty); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	sql, args = botCondition()
+	if want := " OR (" + ipGuard + " AND (" + ipInRange + " OR " + ipInRange + ")))"; !strings.HasSuffix(sql, want) {
+		t.Errorf("botCondition() = %q, want it to end with %q", sql, want)
+	}
+	if want := []any{"::ffff:66.249.64.0/115", "::ffff:198.51.100.0/120"}; !reflect.DeepEqual(args[signatures:], want) {
+		t.Errorf("botCondition() range args = %v, want %v", args[signatures:], want)
+	}
+}
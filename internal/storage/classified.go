@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ThEditor/clutter-studio/internal/geoip"
+	"github.com/ThEditor/clutter-studio/internal/referrer"
+	"github.com/ThEditor/clutter-studio/internal/useragent"
+)
+
+// classifiedDimension is computed in Go from the raw values of a SQL
+// dimension, for lookups ClickHouse cannot do itself.
+type classifiedDimension struct {
+	source   string
+	classify func(s *ClickHouseStorage, q Query, raw string) string
+}
+
+func userAgentDimension(field func(useragent.UserAgent) string) classifiedDimension {
+	return classifiedDimension{
+		source:   "user_agent",
+		classify: func(_ *ClickHouseStorage, _ Query, raw string) string { return field(useragent.Parse(raw)) },
+	}
+}
+
+func geoDimension(field func(geoip.Location) string) classifiedDimension {
+	return classifiedDimension{
+		source:   "ip",
+		classify: func(s *ClickHouseStorage, _ Query, raw string) string { return field(s.geo.Lookup(raw)) },
+	}
+}
+
+func referrerDimension(field func(referrer.Source) string) classifiedDimension {
+	return classifiedDimension{
+		source: "referrer_host",
+		classify: func(_ *ClickHouseStorage, q Query, raw string) string {
+			return field(referrer.Classify(raw, q.SiteDomains))
+		},
+	}
+}
+
+var classifiedDimensions = map[string]classifiedDimension{
+	"browser":         userAgentDimension(func(ua useragent.UserAgent) string { return ua.Browser }),
+	"browser_version": userAgentDimension(func(ua useragent.UserAgent) string { return ua.BrowserVersion }),
+	"os":              userAgentDimension(func(ua useragent.UserAgent) string { return ua.OS }),
+	"os_version":      userAgentDimension(func(ua useragent.UserAgent) string { return ua.OSVersion }),
+	"device":          userAgentDimension(func(ua useragent.UserAgent) string { return ua.Device }),
+	"source":          referrerDimension(func(r referrer.Source) string { return r.Name }),
+	"channel":         referrerDimension(func(r referrer.Source) string { return r.Channel }),
+	"country":         geoDimension(func(l geoip.Location) string { return l.Country }),
+	"region": geoDimension(func(l geoip.Location) string {
+		if l.Region == geoip.Unknown {
+			return geoip.Unknown
+		}
+		return l.Region + ", " + l.Country
+	}),
+	"city": geoDimension(func(l geoip.Location) string {
+		if l.City == geoip.Unknown {
+			return geoip.Unknown
+		}
+		return l.City + ", " + l.Country
+	}),
+}
+
+// SetGeoIP sets the database the country, region and city dimensions are
+// resolved with. Without one they are all Unknown.
+func (s *ClickHouseStorage) SetGeoIP(resolver *geoip.Resolver) {
+	s.geo = resolver
+}
+
+// Caps on the raw values scanned for, and matched by, a classified filter,
+// so a valid filter cannot turn into an unbounded query.
+const (
+	maxDistinctValues = 100000
+	maxResolvedValues = 1000
+)
+
+// ErrTooManyValues is returned by ResolveFilters when a classified filter
+// matches more raw values than a query can list.
+var ErrTooManyValues = errors.New("filter matches too many values, narrow the date range or add filters")
+
+// getDistinctValues returns every distinct value of a SQL dimension for the
+// events matching the query.
+func (s *ClickHouseStorage) getDistinctValues(q Query, dimension string) ([]string, error) {
+	expr, _ := dimensionExpr(dimension)
+	where, args := q.whereAll()
+	rows, err := s.db.Query(`
+		SELECT DISTINCT `+expr+`
+		FROM events
+		WHERE `+where+`
+		LIMIT ?
+	`, append(args, maxDistinctValues+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get distinct values: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan distinct value: %w", err)
+		}
+		results = append(results, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over distinct values: %w", err)
+	}
+	if len(results) > maxDistinctValues {
+		return nil, ErrTooManyValues
+	}
+	return results, nil
+}
+
+// ResolveFilters replaces the filters on classified dimensions with the list
+// of raw values they match, so they can be compiled into SQL. The raw values
+// are looked up among the events matching the other filters.
+func (s *ClickHouseStorage) ResolveFilters(q Query) (Query, error) {
+	plain := q
+	plain.Filters = make([]Filter, 0, len(q.Filters))
+	for _, filter := range q.Filters {
+		if _, ok := classifiedDimensions[filter.Dimension]; !ok {
+			plain.Filters = append(plain.Filters, filter)
+		}
+	}
+
+	rawValues := make(map[string][]string)
+	resolved := make([]Filter, 0, len(q.Filters))
+
+	for _, filter := range q.Filters {
+		dimension, ok := classifiedDimensions[filter.Dimension]
+		if !ok {
+			resolved = append(resolved, filter)
+			continue
+		}
+
+		values, ok := rawValues[dimension.source]
+		if !ok {
+			var err error
+			values, err = s.getDistinctValues(plain, dimension.source)
+			if err != nil {
+				return Query{}, err
+			}
+			rawValues[dimension.source] = values
+		}
+
+		matching := make([]string, 0)
+		for _, raw := range values {
+			if filter.matches(dimension.classify(s, q, raw)) {
+				matching = append(matching, raw)
+			}
+		}
+		if len(matching) > maxResolvedValues {
+			return Query{}, fmt.Errorf("%s: %w", filter.Dimension, ErrTooManyValues)
+		}
+
+		resolved = append(resolved, Filter{Dimension: dimension.source, Op: FilterIn, Values: matching})
+	}
+
+	q.Filters = resolved
+	return q, nil
+}
+
+// getClassifiedBreakdown returns the session metrics grouped by a classified
+// dimension. Visitors are keyed by IP and user agent, so the figures of each
+// raw value add up without double counting.
+func (s *ClickHouseStorage) getClassifiedBreakdown(q Query, name string, limit int, offset int) ([]BreakdownStats, error) {
+	dimension := classifiedDimensions[name]
+	perValue, err := s.querySessionBreakdown(q, dimension.source, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := make(map[string]*BreakdownStats)
+	for _, stats := range perValue {
+		value := dimension.classify(s, q, stats.Value)
+
+		group, ok := grouped[value]
+		if !ok {
+			group = &BreakdownStats{Value: value}
+			grouped[value] = group
+		}
+
+		visits := float64(group.Visits + stats.Visits)
+		if visits > 0 {
+			group.BounceRate = (group.BounceRate*float64(group.Visits) + stats.BounceRate*float64(stats.Visits)) / visits
+			group.VisitDuration = (group.VisitDuration*float64(group.Visits) + stats.VisitDuration*float64(stats.Visits)) / visits
+			group.PagesPerVisit = (group.PagesPerVisit*float64(group.Visits) + stats.PagesPerVisit*float64(stats.Visits)) / visits
+		}
+		group.Visits += stats.Visits
+		group.Visitors += stats.Visitors
+		group.PageViews += stats.PageViews
+	}
+
+	results := make([]BreakdownStats, 0, len(grouped))
+	for _, group := range grouped {
+		group.BounceRate = roundTo2(group.BounceRate)
+		group.VisitDuration = roundTo2(group.VisitDuration)
+		group.PagesPerVisit = roundTo2(group.PagesPerVisit)
+		results = append(results, *group)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Visits != results[j].Visits {
+			return results[i].Visits > results[j].Visits
+		}
+		return results[i].Value < results[j].Value
+	})
+
+	return paginate(results, limit, offset), nil
+}
+
+// paginate returns the page of items selected by limit and offset.
+func paginate[T any](items []T, limit int, offset int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+func roundTo2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -3,14 +3,20 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/ThEditor/clutter-studio/internal/geoip"
+	"github.com/ThEditor/clutter-studio/internal/referrer"
+	"github.com/ThEditor/clutter-studio/internal/useragent"
+
 	_ "github.com/ClickHouse/clickhouse-go"
-	"github.com/google/uuid"
 )
 
 type ClickHouseStorage struct {
-	db *sql.DB
+	db  *sql.DB
+	geo *geoip.Resolver
 }
 
 func NewClickHouseStorage(dsn string) (*ClickHouseStorage, error) {
@@ -25,9 +31,54 @@ func NewClickHouseStorage(dsn string) (*ClickHouseStorage, error) {
 
 	storage := &ClickHouseStorage{db: db}
 
+	if err := storage.checkSchema(); err != nil {
+		return nil, err
+	}
+
 	return storage, nil
 }
 
+// requiredColumns are the columns of the events table added on top of the
+// ones Paper always wrote, by the migrations in clickhouse/migrations.
+var requiredColumns = []string{"event_name", "props", "hostname"}
+
+// checkSchema fails when the events table lacks any of requiredColumns, so
+// that a missing migration stops startup instead of every analytics query.
+func (s *ClickHouseStorage) checkSchema() error {
+	rows, err := s.db.Query(`
+		SELECT name
+		FROM system.columns
+		WHERE database = currentDatabase() AND table = 'events'
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to read events schema: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan events column: %w", err)
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over events columns: %w", err)
+	}
+
+	var missing []string
+	for _, column := range requiredColumns {
+		if !columns[column] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("events table is missing columns %s, apply clickhouse/migrations", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 func (s *ClickHouseStorage) Close() error {
 	return s.db.Close()
 }
@@ -52,15 +103,12 @@ type PageStats struct {
 
 type ReferrerStats struct {
 	Referrer string `json:"referrer"`
+	Channel  string `json:"channel"`
 	Count    int    `json:"count"`
 }
 
-type VisitorStats struct {
-	Day            time.Time `json:"day"`
-	UniqueVisitors int       `json:"unique_visitors"`
-}
-
-func (s *ClickHouseStorage) GetSiteEventData(siteID uuid.UUID) ([]EventData, error) {
+func (s *ClickHouseStorage) GetSiteEventData(q Query) ([]EventData, error) {
+	where, args := q.where()
 	rows, err := s.db.Query(`
 		SELECT 
 			visitor_ip,
@@ -70,8 +118,8 @@ func (s *ClickHouseStorage) GetSiteEventData(siteID uuid.UUID) ([]EventData, err
 			created_on,
 			page
 		FROM events
-		WHERE site_id = ?
-	`, siteID.String())
+		WHERE `+where+`
+	`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query events: %w", err)
 	}
@@ -101,75 +149,103 @@ func (s *ClickHouseStorage) GetSiteEventData(siteID uuid.UUID) ([]EventData, err
 	return events, nil
 }
 
-func (s *ClickHouseStorage) GetUniqueVisitors(siteID uuid.UUID) (int, error) {
+func (s *ClickHouseStorage) GetUniqueVisitors(q Query) (int, error) {
+	where, args := q.where()
 	var uniqueVisitors int
 	err := s.db.QueryRow(`
 		SELECT uniqExact(visitor_ip || visitor_user_agent) AS unique_visitors
 		FROM events
-		WHERE site_id = ?
-	`, siteID.String()).Scan(&uniqueVisitors)
+		WHERE `+where+`
+	`, args...).Scan(&uniqueVisitors)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get unique visitors: %w", err)
 	}
 	return uniqueVisitors, nil
 }
 
-func (s *ClickHouseStorage) GetPageViews(siteID uuid.UUID) (int, error) {
+func (s *ClickHouseStorage) GetPageViews(q Query) (int, error) {
+	where, args := q.where()
 	var pageViews int
 	err := s.db.QueryRow(`
 		SELECT count(*) AS page_views
 		FROM events
-		WHERE site_id = ?
-	`, siteID.String()).Scan(&pageViews)
+		WHERE `+where+`
+	`, args...).Scan(&pageViews)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get page views: %w", err)
 	}
 	return pageViews, nil
 }
 
-func (s *ClickHouseStorage) GetTopReferrers(siteID uuid.UUID, limit int) ([]ReferrerStats, error) {
+// GetTopReferrers counts the pageviews of each traffic source, leaving out
+// direct traffic and referrals from the site's own domains.
+func (s *ClickHouseStorage) GetTopReferrers(q Query, limit int) ([]ReferrerStats, error) {
+	where, args := q.where()
+	host, _ := dimensionExpr("referrer_host")
 	rows, err := s.db.Query(`
-		SELECT referrer, count(*) AS count
+		SELECT `+host+` AS host, count(*) AS count
 		FROM events
-		WHERE site_id = ?
-		GROUP BY referrer
-		ORDER BY count DESC
-		LIMIT ?
-	`, siteID.String(), limit)
+		WHERE `+where+`
+		GROUP BY host
+	`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get top referrers: %w", err)
 	}
 	defer rows.Close()
 
-	var results []ReferrerStats
+	grouped := make(map[string]*ReferrerStats)
 	for rows.Next() {
-		var stats ReferrerStats
-		if err := rows.Scan(&stats.Referrer, &stats.Count); err != nil {
+		var host string
+		var count int
+		if err := rows.Scan(&host, &count); err != nil {
 			return nil, fmt.Errorf("failed to scan referrer stats: %w", err)
 		}
-		results = append(results, stats)
+
+		source := referrer.Classify(host, q.SiteDomains)
+		if source.Channel == referrer.ChannelDirect {
+			continue
+		}
+
+		stats, ok := grouped[source.Name]
+		if !ok {
+			stats = &ReferrerStats{Referrer: source.Name, Channel: source.Channel}
+			grouped[source.Name] = stats
+		}
+		stats.Count += count
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over referrer stats: %w", err)
 	}
-	return results, nil
+
+	results := make([]ReferrerStats, 0, len(grouped))
+	for _, stats := range grouped {
+		results = append(results, *stats)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Count != results[j].Count {
+			return results[i].Count > results[j].Count
+		}
+		return results[i].Referrer < results[j].Referrer
+	})
+	return paginate(results, limit, 0), nil
 }
 
-func (s *ClickHouseStorage) GetTopPages(siteID uuid.UUID, limit int) ([]PageStats, error) {
+func (s *ClickHouseStorage) GetTopPages(q Query, limit int) ([]PageStats, error) {
+	where, args := q.where()
 	rows, err := s.db.Query(`
-		SELECT page, count(*) AS count
+		SELECT `+pagePathExpr+` AS path, count(*) AS count
 		FROM events
-		WHERE site_id = ?
-		GROUP BY page
+		WHERE `+where+`
+		GROUP BY path
 		ORDER BY count DESC
 		LIMIT ?
-	`, siteID.String(), limit)
+	`, append(args, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get top pages: %w", err)
 	}
 	defer rows.Close()
 
-	var results []PageStats
+	results := make([]PageStats, 0)
 	for rows.Next() {
 		var stats PageStats
 		if err := rows.Scan(&stats.Page, &stats.Count); err != nil {
@@ -183,71 +259,45 @@ func (s *ClickHouseStorage) GetTopPages(siteID uuid.UUID, limit int) ([]PageStat
 	return results, nil
 }
 
-func (s *ClickHouseStorage) GetDeviceStats(siteID uuid.UUID) ([]DeviceStats, error) {
+// GetDeviceStats counts the pageviews of each device class, classifying the
+// user agents in Go.
+func (s *ClickHouseStorage) GetDeviceStats(q Query) ([]DeviceStats, error) {
+	where, args := q.where()
 	rows, err := s.db.Query(`
 		SELECT
-		  device_type,
+		  visitor_user_agent,
 		  count(*) AS total
-		FROM (
-		  SELECT
-			CASE
-			  WHEN visitor_user_agent ILIKE '%Mobile%' AND visitor_user_agent ILIKE '%Tablet%' THEN 'Tablet'
-			  WHEN visitor_user_agent ILIKE '%Tablet%' THEN 'Tablet'
-			  WHEN visitor_user_agent ILIKE '%Mobile%' THEN 'Mobile'
-			  ELSE 'Desktop'
-			END AS device_type
-		  FROM events
-		  WHERE site_id = ?
-		)
-		GROUP BY device_type
-		ORDER BY total DESC
-	`, siteID.String())
+		FROM events
+		WHERE `+where+`
+		GROUP BY visitor_user_agent
+	`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get device stats: %w", err)
 	}
 	defer rows.Close()
 
-	var results []DeviceStats
+	counts := make(map[string]int)
 	for rows.Next() {
-		var stats DeviceStats
-		if err := rows.Scan(&stats.DeviceType, &stats.Count); err != nil {
+		var ua string
+		var count int
+		if err := rows.Scan(&ua, &count); err != nil {
 			return nil, fmt.Errorf("failed to scan device stats: %w", err)
 		}
-		results = append(results, stats)
+		counts[useragent.Parse(ua).Device] += count
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over device stats: %w", err)
 	}
-	return results, nil
-}
 
-func (s *ClickHouseStorage) GetVisitorGraph(siteID uuid.UUID, startDate, endDate string) ([]VisitorStats, error) {
-	rows, err := s.db.Query(`
-		SELECT
-		  toDate(created_on) AS day,
-		  uniqExact(visitor_ip || visitor_user_agent) AS unique_visitors
-		FROM events
-		WHERE site_id = ?
-		  AND created_on >= ?
-		  AND created_on < ?
-		GROUP BY day
-		ORDER BY day ASC
-	`, siteID.String(), startDate, endDate)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get visitor graph data: %w", err)
+	results := make([]DeviceStats, 0, len(counts))
+	for device, count := range counts {
+		results = append(results, DeviceStats{DeviceType: device, Count: count})
 	}
-	defer rows.Close()
-
-	var results []VisitorStats
-	for rows.Next() {
-		var stats VisitorStats
-		if err := rows.Scan(&stats.Day, &stats.UniqueVisitors); err != nil {
-			return nil, fmt.Errorf("failed to scan visitor stats: %w", err)
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Count != results[j].Count {
+			return results[i].Count > results[j].Count
 		}
-		results = append(results, stats)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over visitor stats: %w", err)
-	}
+		return results[i].DeviceType < results[j].DeviceType
+	})
 	return results, nil
 }
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PageviewEvent is the event_name Paper records pageviews with. Every other
+// name is a custom event, whose properties are stored in the props map.
+const PageviewEvent = "pageview"
+
+const (
+	GoalKindEvent = "event"
+	GoalKindPage  = "page"
+)
+
+// Goal is reached by a custom event named Pattern, or by a pageview whose
+// path matches Pattern, where * matches any characters.
+type Goal struct {
+	Name    string
+	Kind    string
+	Pattern string
+}
+
+type GoalConversion struct {
+	Name           string  `json:"name"`
+	Kind           string  `json:"kind"`
+	Pattern        string  `json:"pattern"`
+	Visitors       int     `json:"visitors"`
+	Conversions    int     `json:"conversions"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+type EventStats struct {
+	Name     string `json:"name"`
+	Visitors int    `json:"visitors"`
+	Count    int    `json:"count"`
+}
+
+type PropertyStats struct {
+	Value    string `json:"value"`
+	Visitors int    `json:"visitors"`
+	Count    int    `json:"count"`
+}
+
+// likePattern turns a path glob into a LIKE pattern.
+func likePattern(glob string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(glob)
+	return strings.ReplaceAll(escaped, "*", "%")
+}
+
+// matchCondition renders the condition matching the custom events named
+// pattern, or the pageviews whose path matches the pattern for GoalKindPage.
+func matchCondition(kind string, pattern string) (string, []any) {
+	if kind == GoalKindPage {
+		return "(event_name = '" + PageviewEvent + "' AND " + pagePathExpr + " LIKE ?)", []any{likePattern(pattern)}
+	}
+	return "event_name = ?", []any{pattern}
+}
+
+// GetGoalConversions returns, for each goal, the visitors who reached it,
+// how often it was reached and the share of all visitors that converted.
+func (s *ClickHouseStorage) GetGoalConversions(q Query, goals []Goal) ([]GoalConversion, error) {
+	results := make([]GoalConversion, 0, len(goals))
+	if len(goals) == 0 {
+		return results, nil
+	}
+
+	columns := []string{"uniqExact(visitor_ip || visitor_user_agent)"}
+	var args []any
+	for _, goal := range goals {
+		condition, conditionArgs := matchCondition(goal.Kind, goal.Pattern)
+		columns = append(columns,
+			"uniqExactIf(visitor_ip || visitor_user_agent, "+condition+")",
+			"countIf("+condition+")",
+		)
+		args = append(args, conditionArgs...)
+		args = append(args, conditionArgs...)
+	}
+
+	where, whereArgs := q.whereAll()
+	var total int
+	conversions := make([]GoalConversion, len(goals))
+	dest := []any{&total}
+	for i := range conversions {
+		dest = append(dest, &conversions[i].Visitors, &conversions[i].Conversions)
+	}
+
+	err := s.db.QueryRow(`
+		SELECT
+		  `+strings.Join(columns, ",\n\t\t  ")+`
+		FROM events
+		WHERE `+where+`
+	`, append(args, whereArgs...)...).Scan(dest...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get goal conversions: %w", err)
+	}
+
+	for i, goal := range goals {
+		conversion := conversions[i]
+		conversion.Name = goal.Name
+		conversion.Kind = goal.Kind
+		conversion.Pattern = goal.Pattern
+		if total > 0 {
+			conversion.ConversionRate = roundTo2(float64(conversion.Visitors) * 100 / float64(total))
+		}
+		results = append(results, conversion)
+	}
+	return results, nil
+}
+
+// GetCustomEvents returns the most frequent custom events.
+func (s *ClickHouseStorage) GetCustomEvents(q Query, limit int) ([]EventStats, error) {
+	where, args := q.whereAll()
+	rows, err := s.db.Query(`
+		SELECT
+		  event_name,
+		  uniqExact(visitor_ip || visitor_user_agent) AS visitors,
+		  count(*) AS count
+		FROM events
+		WHERE event_name != '`+PageviewEvent+`'
+		  AND `+where+`
+		GROUP BY event_name
+		ORDER BY count DESC, event_name
+		LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get custom events: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]EventStats, 0)
+	for rows.Next() {
+		var stats EventStats
+		if err := rows.Scan(&stats.Name, &stats.Visitors, &stats.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan custom event stats: %w", err)
+		}
+		results = append(results, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over custom event stats: %w", err)
+	}
+	return results, nil
+}
+
+// GetEventProperties breaks a custom event down by the values of one of its
+// properties.
+func (s *ClickHouseStorage) GetEventProperties(q Query, event string, property string, limit int, offset int) ([]PropertyStats, error) {
+	where, args := q.whereAll()
+	rows, err := s.db.Query(`
+		SELECT
+		  props[?] AS value,
+		  uniqExact(visitor_ip || visitor_user_agent) AS visitors,
+		  count(*) AS count
+		FROM events
+		WHERE event_name = ?
+		  AND `+where+`
+		GROUP BY value
+		ORDER BY count DESC, value
+		LIMIT ? OFFSET ?
+	`, append(append([]any{property, event}, args...), limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event properties: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]PropertyStats, 0)
+	for rows.Next() {
+		var stats PropertyStats
+		if err := rows.Scan(&stats.Value, &stats.Visitors, &stats.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan event property stats: %w", err)
+		}
+		results = append(results, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over event property stats: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLikePattern(t *testing.T) {
+	tests := map[string]string{
+		"/pricing":      "/pricing",
+		"/blog/*":       "/blog/%",
+		"*/checkout/*":  "%/checkout/%",
+		"/100%":         `/100\%`,
+		"/sign_up":      `/sign\_up`,
+		`/a\b`:          `/a\\b`,
+		`/a\*`:          `/a\\%`,
+		"/docs_*/50%_*": `/docs\_%/50\%\_%`,
+		"":              "",
+		"*":             "%",
+	}
+
+	for glob, want := range tests {
+		if got := likePattern(glob); got != want {
+			t.Errorf("likePattern(%q) = %q, want %q", glob, got, want)
+		}
+	}
+}
+
+func TestMatchCondition(t *testing.T) {
+	sql, args := matchCondition(GoalKindPage, "/thank_you*")
+	if want := "(event_name = 'pageview' AND cutQueryStringAndFragment(page) LIKE ?)"; sql != want {
+		t.Errorf("page goal sql = %q, want %q", sql, want)
+	}
+	if want := []any{`/thank\_you%`}; !reflect.DeepEqual(args, want) {
+		t.Errorf("page goal args = %v, want %v", args, want)
+	}
+
+	// event goals match the name exactly, so wildcards are not expanded
+	sql, args = matchCondition(GoalKindEvent, "signup_*")
+	if want := "event_name = ?"; sql != want {
+		t.Errorf("event goal sql = %q, want %q", sql, want)
+	}
+	if want := []any{"signup_*"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("event goal args = %v, want %v", args, want)
+	}
+}
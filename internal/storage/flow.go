@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type FlowDirection string
+
+const (
+	FlowNext     FlowDirection = "next"
+	FlowPrevious FlowDirection = "previous"
+)
+
+type FlowNode struct {
+	ID       string `json:"id"`
+	Step     int    `json:"step"`
+	Page     string `json:"page"`
+	Visitors int    `json:"visitors"`
+}
+
+type FlowLink struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Visitors int    `json:"visitors"`
+}
+
+// Flow is a Sankey-ready graph of the pages visitors went to after (or came
+// from before) a page, one column of nodes per step.
+type Flow struct {
+	Nodes []FlowNode `json:"nodes"`
+	Links []FlowLink `json:"links"`
+}
+
+func flowNodeID(step int, page string) string {
+	return strconv.Itoa(step) + ":" + page
+}
+
+// visitorPagesQuery renders a subquery with the page paths of each visitor in
+// the order they were viewed, repeated views of the same page collapsed and
+// reversed when walking backwards.
+func (q Query) visitorPagesQuery(direction FlowDirection) (string, []any) {
+	where, args := q.where()
+
+	pages := "arrayFilter((p, i) -> i = 1 OR p != all_pages[i - 1], all_pages, arrayEnumerate(all_pages))"
+	if direction == FlowPrevious {
+		pages = "reverse(" + pages + ")"
+	}
+
+	return `
+		SELECT ` + pages + ` AS pages
+		FROM (
+		  SELECT arrayMap(x -> x.2, arraySort(x -> x.1, groupArray((created_on, ` + pagePathExpr + `)))) AS all_pages
+		  FROM events
+		  WHERE ` + where + `
+		  GROUP BY visitor_ip || visitor_user_agent
+		)
+	`, args
+}
+
+// GetFlow follows visitors of page for up to steps pages in the direction,
+// keeping the limit most visited pages of each step.
+func (s *ClickHouseStorage) GetFlow(q Query, page string, direction FlowDirection, steps int, limit int) (*Flow, error) {
+	visitorPages, args := q.visitorPagesQuery(direction)
+
+	var total int
+	err := s.db.QueryRow(`
+		SELECT count(*)
+		FROM (`+visitorPages+`)
+		WHERE has(pages, ?)
+	`, append(append([]any{}, args...), page)...).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flow visitors: %w", err)
+	}
+
+	flow := &Flow{Nodes: make([]FlowNode, 0), Links: make([]FlowLink, 0)}
+	if total == 0 {
+		return flow, nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT i AS step, seq[i] AS source, seq[i + 1] AS target, count(*) AS visitors
+		FROM (
+		  SELECT arraySlice(pages, indexOf(pages, ?), ?) AS seq
+		  FROM (`+visitorPages+`)
+		  WHERE has(pages, ?)
+		)
+		ARRAY JOIN arrayEnumerate(arrayPopBack(seq)) AS i
+		GROUP BY step, source, target
+	`, append(append([]any{page, steps + 1}, args...), page)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flow: %w", err)
+	}
+	defer rows.Close()
+
+	type stepLink struct {
+		FlowLink
+		page string
+	}
+
+	// links by the step of their target
+	linksByStep := make([][]stepLink, steps+1)
+	for rows.Next() {
+		var step int
+		var source, target string
+		var visitors int
+		if err := rows.Scan(&step, &source, &target, &visitors); err != nil {
+			return nil, fmt.Errorf("failed to scan flow link: %w", err)
+		}
+		if step < 1 || step > steps {
+			continue
+		}
+		linksByStep[step] = append(linksByStep[step], stepLink{
+			FlowLink: FlowLink{
+				Source:   flowNodeID(step-1, source),
+				Target:   flowNodeID(step, target),
+				Visitors: visitors,
+			},
+			page: target,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over flow links: %w", err)
+	}
+
+	flow.Nodes = append(flow.Nodes, FlowNode{ID: flowNodeID(0, page), Step: 0, Page: page, Visitors: total})
+	kept := map[string]bool{flowNodeID(0, page): true}
+
+	for step := 1; step <= steps; step++ {
+		nodes := make(map[string]*FlowNode)
+		for _, link := range linksByStep[step] {
+			if !kept[link.Source] {
+				continue
+			}
+			node, ok := nodes[link.Target]
+			if !ok {
+				node = &FlowNode{ID: link.Target, Step: step, Page: link.page}
+				nodes[link.Target] = node
+			}
+			node.Visitors += link.Visitors
+		}
+
+		ranked := make([]FlowNode, 0, len(nodes))
+		for _, node := range nodes {
+			ranked = append(ranked, *node)
+		}
+		sort.Slice(ranked, func(i, j int) bool {
+			if ranked[i].Visitors != ranked[j].Visitors {
+				return ranked[i].Visitors > ranked[j].Visitors
+			}
+			return ranked[i].Page < ranked[j].Page
+		})
+		ranked = paginate(ranked, limit, 0)
+
+		for _, node := range ranked {
+			kept[node.ID] = true
+		}
+		flow.Nodes = append(flow.Nodes, ranked...)
+
+		links := make([]FlowLink, 0)
+		for _, link := range linksByStep[step] {
+			if kept[link.Source] && kept[link.Target] {
+				links = append(links, link.FlowLink)
+			}
+		}
+		sort.Slice(links, func(i, j int) bool { return links[i].Visitors > links[j].Visitors })
+		flow.Links = append(flow.Links, links...)
+	}
+
+	return flow, nil
+}
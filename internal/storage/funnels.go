@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FunnelStep is reached like a Goal of the same kind and pattern.
+type FunnelStep struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern"`
+}
+
+type FunnelStepStats struct {
+	FunnelStep
+	Visitors int `json:"visitors"`
+	// ConversionRate is the share of the first step's visitors that reached
+	// this step, StepConversionRate the share of the previous step's.
+	ConversionRate     float64 `json:"conversion_rate"`
+	StepConversionRate float64 `json:"step_conversion_rate"`
+	DropOff            int     `json:"drop_off"`
+}
+
+// GetFunnel returns how many visitors completed each step of the funnel in
+// order, each step within window of the first one.
+func (s *ClickHouseStorage) GetFunnel(q Query, steps []FunnelStep, window time.Duration) ([]FunnelStepStats, error) {
+	conditions := make([]string, 0, len(steps))
+	var conditionArgs []any
+	for _, step := range steps {
+		condition, args := matchCondition(step.Kind, step.Pattern)
+		conditions = append(conditions, condition)
+		conditionArgs = append(conditionArgs, args...)
+	}
+
+	where, whereArgs := q.whereAll()
+	args := append(append(append([]any{}, conditionArgs...), whereArgs...), conditionArgs...)
+
+	rows, err := s.db.Query(`
+		SELECT level, count(*) AS visitors
+		FROM (
+		  SELECT
+		    visitor_ip || visitor_user_agent AS visitor,
+		    windowFunnel(`+fmt.Sprint(int(window.Seconds()))+`)(created_on, `+strings.Join(conditions, ", ")+`) AS level
+		  FROM events
+		  WHERE `+where+`
+		    AND (`+strings.Join(conditions, " OR ")+`)
+		  GROUP BY visitor
+		)
+		GROUP BY level
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get funnel: %w", err)
+	}
+	defer rows.Close()
+
+	// visitors whose furthest step is the index
+	reached := make([]int, len(steps)+1)
+	for rows.Next() {
+		var level, visitors int
+		if err := rows.Scan(&level, &visitors); err != nil {
+			return nil, fmt.Errorf("failed to scan funnel level: %w", err)
+		}
+		if level >= 0 && level < len(reached) {
+			reached[level] = visitors
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over funnel levels: %w", err)
+	}
+
+	return funnelStats(steps, reached), nil
+}
+
+// funnelStats computes the visitors and rates of every step from the number
+// of visitors whose furthest step is the index, where index 0 counts the
+// visitors who never completed the first step.
+func funnelStats(steps []FunnelStep, reached []int) []FunnelStepStats {
+	results := make([]FunnelStepStats, len(steps))
+	completed := 0
+	for i := len(steps) - 1; i >= 0; i-- {
+		completed += reached[i+1]
+		results[i] = FunnelStepStats{FunnelStep: steps[i], Visitors: completed}
+	}
+
+	for i := range results {
+		if results[0].Visitors > 0 {
+			results[i].ConversionRate = roundTo2(float64(results[i].Visitors) * 100 / float64(results[0].Visitors))
+		}
+		if i == 0 {
+			if results[0].Visitors > 0 {
+				results[0].StepConversionRate = 100
+			}
+			continue
+		}
+		if previous := results[i-1].Visitors; previous > 0 {
+			results[i].StepConversionRate = roundTo2(float64(results[i].Visitors) * 100 / float64(previous))
+		}
+		results[i].DropOff = results[i-1].Visitors - results[i].Visitors
+	}
+
+	return results
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFunnelStats(t *testing.T) {
+	steps := []FunnelStep{
+		{Name: "Landing", Kind: GoalKindPage, Pattern: "/"},
+		{Name: "Pricing", Kind: GoalKindPage, Pattern: "/pricing"},
+		{Name: "Signup", Kind: GoalKindEvent, Pattern: "signup"},
+	}
+
+	stats := func(visitors int, conversion, step float64, dropOff int) FunnelStepStats {
+		return FunnelStepStats{Visitors: visitors, ConversionRate: conversion, StepConversionRate: step, DropOff: dropOff}
+	}
+
+	tests := []struct {
+		name    string
+		reached []int
+		want    []FunnelStepStats
+	}{
+		{
+			name:    "visitors are counted in every step they passed",
+			reached: []int{0, 50, 30, 20},
+			want:    []FunnelStepStats{stats(100, 100, 100, 0), stats(50, 50, 50, 50), stats(20, 20, 40, 30)},
+		},
+		{
+			name:    "rates are rounded",
+			reached: []int{0, 1, 1, 1},
+			want:    []FunnelStepStats{stats(3, 100, 100, 0), stats(2, 66.67, 66.67, 1), stats(1, 33.33, 50, 1)},
+		},
+		{
+			name:    "visitors who never started are ignored",
+			reached: []int{500, 10, 0, 0},
+			want:    []FunnelStepStats{stats(10, 100, 100, 0), stats(0, 0, 0, 10), stats(0, 0, 0, 0)},
+		},
+		{
+			name:    "nobody reached the first step",
+			reached: []int{7, 0, 0, 0},
+			want:    []FunnelStepStats{stats(0, 0, 0, 0), stats(0, 0, 0, 0), stats(0, 0, 0, 0)},
+		},
+		{
+			name:    "everyone completed the funnel",
+			reached: []int{0, 0, 0, 8},
+			want:    []FunnelStepStats{stats(8, 100, 100, 0), stats(8, 100, 100, 0), stats(8, 100, 100, 0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.want {
+				tt.want[i].FunnelStep = steps[i]
+			}
+			if got := funnelStats(steps, tt.reached); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("funnelStats(%v) = %+v, want %+v", tt.reached, got, tt.want)
+			}
+		})
+	}
+}
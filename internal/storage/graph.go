@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+type Granularity string
+
+const (
+	GranularityHour  Granularity = "hour"
+	GranularityDay   Granularity = "day"
+	GranularityWeek  Granularity = "week"
+	GranularityMonth Granularity = "month"
+)
+
+type GraphMetric string
+
+const (
+	MetricVisitors   GraphMetric = "visitors"
+	MetricPageViews  GraphMetric = "pageviews"
+	MetricVisits     GraphMetric = "visits"
+	MetricBounceRate GraphMetric = "bounce_rate"
+)
+
+type GraphPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// bucketExpr truncates a DateTime column to the start of its bucket in the
+// given timezone.
+func bucketExpr(granularity Granularity, column string, loc *time.Location) string {
+	tz := "'" + loc.String() + "'"
+	switch granularity {
+	case GranularityHour:
+		return "toStartOfHour(" + column + ", " + tz + ")"
+	case GranularityWeek:
+		return "toDateTime(toMonday(" + column + ", " + tz + "), " + tz + ")"
+	case GranularityMonth:
+		return "toDateTime(toStartOfMonth(" + column + ", " + tz + "), " + tz + ")"
+	default:
+		return "toStartOfDay(" + column + ", " + tz + ")"
+	}
+}
+
+// GraphBuckets returns the start of every bucket of the given granularity
+// in the timezone loc that overlaps the range.
+func GraphBuckets(tr TimeRange, granularity Granularity, loc *time.Location) []time.Time {
+	start := tr.From.In(loc)
+	var next func(time.Time) time.Time
+
+	switch granularity {
+	case GranularityHour:
+		start = time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, loc)
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case GranularityWeek:
+		start = time.Date(start.Year(), start.Month(), start.Day()-(int(start.Weekday())+6)%7, 0, 0, 0, 0, loc)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case GranularityMonth:
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	}
+
+	var buckets []time.Time
+	for t := start; t.Before(tr.To); t = next(t) {
+		buckets = append(buckets, t)
+	}
+	return buckets
+}
+
+// GetGraph returns the metric for every bucket of the query's range,
+// including buckets without any events.
+func (s *ClickHouseStorage) GetGraph(q Query, granularity Granularity, metric GraphMetric) ([]GraphPoint, error) {
+	var query string
+	var args []any
+
+	switch metric {
+	case MetricVisits, MetricBounceRate:
+		value := "count(*)"
+		if metric == MetricBounceRate {
+			value = "round(countIf(pageviews = 1) * 100 / count(*), 2)"
+		}
+
+		var sessions string
+		sessions, args = q.sessions("")
+		query = `
+		SELECT
+		  ` + bucketExpr(granularity, "session_start", q.location()) + ` AS bucket,
+		  ` + value + ` AS value
+		FROM (` + sessions + `)
+		GROUP BY bucket
+	`
+	default:
+		value := "uniqExact(visitor_ip || visitor_user_agent)"
+		if metric == MetricPageViews {
+			value = "count(*)"
+		}
+
+		var where string
+		where, args = q.where()
+		query = `
+		SELECT
+		  ` + bucketExpr(granularity, "created_on", q.location()) + ` AS bucket,
+		  ` + value + ` AS value
+		FROM events
+		WHERE ` + where + `
+		GROUP BY bucket
+	`
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph data: %w", err)
+	}
+	defer rows.Close()
+
+	values := make(map[int64]float64)
+	for rows.Next() {
+		var point GraphPoint
+		if err := rows.Scan(&point.Time, &point.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan graph point: %w", err)
+		}
+		values[point.Time.Unix()] = point.Value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over graph points: %w", err)
+	}
+
+	return zeroFill(GraphBuckets(q.Range, granularity, q.location()), values), nil
+}
+
+// zeroFill returns a point for every bucket, taking its value from values,
+// keyed by Unix time, or zero for buckets without events.
+func zeroFill(buckets []time.Time, values map[int64]float64) []GraphPoint {
+	results := make([]GraphPoint, 0, len(buckets))
+	for _, bucket := range buckets {
+		results = append(results, GraphPoint{
+			Time:  bucket,
+			Value: values[bucket.Unix()],
+		})
+	}
+	return results
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGraphBuckets(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utc := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name        string
+		tr          TimeRange
+		granularity Granularity
+		loc         *time.Location
+		wantLen     int
+		wantFirst   time.Time
+		wantLast    time.Time
+	}{
+		{
+			name:        "hours of a day",
+			tr:          TimeRange{From: utc("2024-03-01T00:00:00Z"), To: utc("2024-03-02T00:00:00Z")},
+			granularity: GranularityHour,
+			loc:         time.UTC,
+			wantLen:     24,
+			wantFirst:   utc("2024-03-01T00:00:00Z"),
+			wantLast:    utc("2024-03-01T23:00:00Z"),
+		},
+		{
+			name:        "partial hours are included",
+			tr:          TimeRange{From: utc("2024-03-01T10:30:00Z"), To: utc("2024-03-01T12:15:00Z")},
+			granularity: GranularityHour,
+			loc:         time.UTC,
+			wantLen:     3,
+			wantFirst:   utc("2024-03-01T10:00:00Z"),
+			wantLast:    utc("2024-03-01T12:00:00Z"),
+		},
+		{
+			name:        "days of a week",
+			tr:          TimeRange{From: utc("2024-03-01T00:00:00Z"), To: utc("2024-03-08T00:00:00Z")},
+			granularity: GranularityDay,
+			loc:         time.UTC,
+			wantLen:     7,
+			wantFirst:   utc("2024-03-01T00:00:00Z"),
+			wantLast:    utc("2024-03-07T00:00:00Z"),
+		},
+		{
+			name:        "days start at local midnight",
+			tr:          TimeRange{From: utc("2024-03-01T05:00:00Z"), To: utc("2024-03-03T05:00:00Z")},
+			granularity: GranularityDay,
+			loc:         newYork,
+			wantLen:     2,
+			wantFirst:   utc("2024-03-01T05:00:00Z"),
+			wantLast:    utc("2024-03-02T05:00:00Z"),
+		},
+		{
+			name:        "days across daylight saving time",
+			tr:          TimeRange{From: utc("2024-11-02T04:00:00Z"), To: utc("2024-11-05T05:00:00Z")},
+			granularity: GranularityDay,
+			loc:         newYork,
+			wantLen:     3,
+			wantFirst:   utc("2024-11-02T04:00:00Z"),
+			wantLast:    utc("2024-11-04T05:00:00Z"),
+		},
+		{
+			name:        "hours across daylight saving time",
+			tr:          TimeRange{From: utc("2024-11-03T04:00:00Z"), To: utc("2024-11-04T05:00:00Z")},
+			granularity: GranularityHour,
+			loc:         newYork,
+			wantLen:     25,
+			wantFirst:   utc("2024-11-03T04:00:00Z"),
+			wantLast:    utc("2024-11-04T04:00:00Z"),
+		},
+		{
+			name:        "weeks start on monday",
+			tr:          TimeRange{From: utc("2024-03-01T00:00:00Z"), To: utc("2024-03-15T00:00:00Z")},
+			granularity: GranularityWeek,
+			loc:         time.UTC,
+			wantLen:     3,
+			wantFirst:   utc("2024-02-26T00:00:00Z"),
+			wantLast:    utc("2024-03-11T00:00:00Z"),
+		},
+		{
+			name:        "months of a year",
+			tr:          TimeRange{From: utc("2024-01-15T00:00:00Z"), To: utc("2024-12-31T00:00:00Z")},
+			granularity: GranularityMonth,
+			loc:         time.UTC,
+			wantLen:     12,
+			wantFirst:   utc("2024-01-01T00:00:00Z"),
+			wantLast:    utc("2024-12-01T00:00:00Z"),
+		},
+		{
+			name:        "empty range",
+			tr:          TimeRange{From: utc("2024-03-01T00:00:00Z"), To: utc("2024-03-01T00:00:00Z")},
+			granularity: GranularityDay,
+			loc:         time.UTC,
+			wantLen:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GraphBuckets(tt.tr, tt.granularity, tt.loc)
+			if len(got) != tt.wantLen {
+				t.Fatalf("GraphBuckets() returned %d buckets, want %d: %v", len(got), tt.wantLen, got)
+			}
+			if tt.wantLen == 0 {
+				return
+			}
+			if !got[0].Equal(tt.wantFirst) {
+				t.Errorf("first bucket = %v, want %v", got[0], tt.wantFirst)
+			}
+			if !got[len(got)-1].Equal(tt.wantLast) {
+				t.Errorf("last bucket = %v, want %v", got[len(got)-1], tt.wantLast)
+			}
+			for i := 1; i < len(got); i++ {
+				if !got[i].After(got[i-1]) {
+					t.Fatalf("bucket %d (%v) is not after bucket %d (%v)", i, got[i], i-1, got[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestZeroFill(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name    string
+		buckets []time.Time
+		values  map[int64]float64
+		want    []GraphPoint
+	}{
+		{
+			name:    "missing buckets are zero",
+			buckets: []time.Time{day(1), day(2), day(3)},
+			values:  map[int64]float64{day(2).Unix(): 5},
+			want:    []GraphPoint{{Time: day(1), Value: 0}, {Time: day(2), Value: 5}, {Time: day(3), Value: 0}},
+		},
+		{
+			name:    "values outside the buckets are dropped",
+			buckets: []time.Time{day(1)},
+			values:  map[int64]float64{day(1).Unix(): 1.5, day(9).Unix(): 7},
+			want:    []GraphPoint{{Time: day(1), Value: 1.5}},
+		},
+		{
+			name:    "no values",
+			buckets: []time.Time{day(1), day(2)},
+			values:  map[int64]float64{},
+			want:    []GraphPoint{{Time: day(1), Value: 0}, {Time: day(2), Value: 0}},
+		},
+		{
+			name:    "no buckets",
+			buckets: nil,
+			values:  map[int64]float64{day(1).Unix(): 3},
+			want:    []GraphPoint{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := zeroFill(tt.buckets, tt.values)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("zeroFill() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
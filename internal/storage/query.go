@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TimeRange is the half-open [From, To) window every analytics query is
+// restricted to.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Query selects the events an analytics method aggregates over.
+type Query struct {
+	SiteID  uuid.UUID
+	Range   TimeRange
+	Filters []Filter
+	// SessionTimeout overrides DefaultSessionTimeout when positive.
+	SessionTimeout time.Duration
+	// SiteDomains are the site's own domains, whose referrals are internal
+	// navigation rather than traffic sources.
+	SiteDomains []string
+	// IncludeBots keeps the events of bots, which are otherwise excluded.
+	IncludeBots bool
+	// Location is the timezone dates are bucketed in, UTC when nil.
+	Location *time.Location
+	// ExcludedIPs are CIDR ranges whose events are left out.
+	ExcludedIPs []string
+	// ExcludedPaths are page path globs, where * matches any characters,
+	// whose events are left out.
+	ExcludedPaths []string
+}
+
+// location returns the timezone of the query.
+func (q Query) location() *time.Location {
+	if q.Location == nil {
+		return time.UTC
+	}
+	return q.Location
+}
+
+type FilterOp string
+
+const (
+	FilterEquals    FilterOp = "=="
+	FilterNotEquals FilterOp = "!="
+	FilterContains  FilterOp = "*="
+	FilterPrefix    FilterOp = "^="
+	// FilterIn matches any of Values. It cannot be written in filter
+	// expressions and is produced by ClickHouseStorage.ResolveFilters.
+	FilterIn FilterOp = "in"
+)
+
+var filterOps = []FilterOp{FilterEquals, FilterNotEquals, FilterContains, FilterPrefix}
+
+// Filter restricts a query to events whose dimension matches Value, or any
+// of Values for FilterIn.
+type Filter struct {
+	Dimension string
+	Op        FilterOp
+	Value     string
+	Values    []string
+}
+
+// pagePathExpr is the page without its query string, so that tagged links
+// count towards the page they point to.
+const pagePathExpr = "cutQueryStringAndFragment(page)"
+
+// urlParameterExpr extracts a decoded query string parameter of the page.
+func urlParameterExpr(name string) string {
+	return "decodeURLComponent(extractURLParameter(page, '" + name + "'))"
+}
+
+// filterDimensions maps the dimension names accepted in filter expressions
+// to the ClickHouse expression they compare against.
+var filterDimensions = map[string]string{
+	"page":         pagePathExpr,
+	"referrer":     "referrer",
+	"user_agent":   "visitor_user_agent",
+	"hostname":     "lower(hostname)",
+	"utm_source":   urlParameterExpr("utm_source"),
+	"utm_medium":   urlParameterExpr("utm_medium"),
+	"utm_campaign": urlParameterExpr("utm_campaign"),
+	"utm_term":     urlParameterExpr("utm_term"),
+	"utm_content":  urlParameterExpr("utm_content"),
+}
+
+// internalDimensions can be grouped and filtered on by the storage itself but
+// are not exposed to filter expressions.
+var internalDimensions = map[string]string{
+	"ip":            "visitor_ip",
+	"referrer_host": "lower(domain(referrer))",
+}
+
+// dimensionExpr returns the ClickHouse expression of a SQL dimension.
+func dimensionExpr(dimension string) (string, bool) {
+	if expr, ok := filterDimensions[dimension]; ok {
+		return expr, true
+	}
+	expr, ok := internalDimensions[dimension]
+	return expr, ok
+}
+
+const maxFilters = 10
+
+// ParseFilters parses a filter expression such as
+// "page==/pricing;device==Mobile" into its individual filters.
+func ParseFilters(expr string) ([]Filter, error) {
+	var filters []Filter
+	if expr == "" {
+		return filters, nil
+	}
+
+	for _, part := range strings.Split(expr, ";") {
+		if part == "" {
+			continue
+		}
+
+		filter, err := parseFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(filters) > maxFilters {
+		return nil, fmt.Errorf("at most %d filters are allowed", maxFilters)
+	}
+
+	return filters, nil
+}
+
+func parseFilter(part string) (Filter, error) {
+	for i := 0; i+2 <= len(part); i++ {
+		for _, op := range filterOps {
+			if part[i:i+2] != string(op) {
+				continue
+			}
+
+			dimension := strings.TrimSpace(part[:i])
+			if !IsBreakdownDimension(dimension) {
+				return Filter{}, fmt.Errorf("unknown filter dimension %q", dimension)
+			}
+
+			return Filter{Dimension: dimension, Op: op, Value: part[i+2:]}, nil
+		}
+	}
+
+	return Filter{}, fmt.Errorf("invalid filter %q", part)
+}
+
+// sql renders the filter as a parameterized condition.
+func (f Filter) sql() (string, []any) {
+	expr, _ := dimensionExpr(f.Dimension)
+
+	switch f.Op {
+	case FilterIn:
+		if len(f.Values) == 0 {
+			return "0", nil
+		}
+		return inCondition(expr, f.Values)
+	case FilterNotEquals:
+		return "(" + expr + ") != ?", []any{f.Value}
+	case FilterContains:
+		return "positionCaseInsensitive(" + expr + ", ?) > 0", []any{f.Value}
+	case FilterPrefix:
+		return "startsWith(" + expr + ", ?)", []any{f.Value}
+	default:
+		return "(" + expr + ") = ?", []any{f.Value}
+	}
+}
+
+// inCondition renders a condition matching any of values, which must not be
+// empty.
+func inCondition(expr string, values []string) (string, []any) {
+	args := make([]any, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+	return expr + " IN (" + placeholders(len(values)) + ")", args
+}
+
+// placeholders returns n comma separated parameter placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// matches evaluates the filter against a value computed in Go.
+func (f Filter) matches(value string) bool {
+	switch f.Op {
+	case FilterIn:
+		return slices.Contains(f.Values, value)
+	case FilterNotEquals:
+		return value != f.Value
+	case FilterContains:
+		return strings.Contains(strings.ToLower(value), strings.ToLower(f.Value))
+	case FilterPrefix:
+		return strings.HasPrefix(value, f.Value)
+	default:
+		return value == f.Value
+	}
+}
+
+// where renders the conditions shared by every pageview query, to be used
+// after WHERE with the returned arguments bound in order.
+func (q Query) where() (string, []any) {
+	where, args := q.whereAll()
+	return "event_name = '" + PageviewEvent + "'\n\t\t  AND " + where, args
+}
+
+// whereAll is where without the restriction to pageviews, for queries over
+// custom events.
+func (q Query) whereAll() (string, []any) {
+	conditions := []string{"site_id = ?", "created_on >= ?", "created_on < ?"}
+	args := []any{q.SiteID.String(), q.Range.From, q.Range.To}
+
+	for _, filter := range q.Filters {
+		condition, filterArgs := filter.sql()
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+	}
+
+	for _, path := range q.ExcludedPaths {
+		conditions = append(conditions, pagePathExpr+" NOT LIKE ?")
+		args = append(args, likePattern(path))
+	}
+
+	if len(q.ExcludedIPs) > 0 {
+		condition, rangeArgs := ipRangesCondition(q.ExcludedIPs)
+		conditions = append(conditions, "NOT "+condition)
+		args = append(args, rangeArgs...)
+	}
+
+	if !q.IncludeBots {
+		condition, botArgs := botCondition()
+		conditions = append(conditions, "NOT "+condition)
+		args = append(args, botArgs...)
+	}
+
+	return strings.Join(conditions, "\n\t\t  AND "), args
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		part    string
+		want    Filter
+		wantErr bool
+	}{
+		{name: "equals", part: "page==/pricing", want: Filter{Dimension: "page", Op: FilterEquals, Value: "/pricing"}},
+		{name: "not equals", part: "referrer!=google.com", want: Filter{Dimension: "referrer", Op: FilterNotEquals, Value: "google.com"}},
+		{name: "contains", part: "page*=blog", want: Filter{Dimension: "page", Op: FilterContains, Value: "blog"}},
+		{name: "prefix", part: "page^=/docs/", want: Filter{Dimension: "page", Op: FilterPrefix, Value: "/docs/"}},
+		{name: "classified dimension", part: "device==Mobile", want: Filter{Dimension: "device", Op: FilterEquals, Value: "Mobile"}},
+		{name: "first operator wins", part: "page==a!=b", want: Filter{Dimension: "page", Op: FilterEquals, Value: "a!=b"}},
+		{name: "first operator wins reversed", part: "page!=a==b", want: Filter{Dimension: "page", Op: FilterNotEquals, Value: "a==b"}},
+		{name: "operator repeated in value", part: "referrer====", want: Filter{Dimension: "referrer", Op: FilterEquals, Value: "=="}},
+		{name: "empty value", part: "referrer==", want: Filter{Dimension: "referrer", Op: FilterEquals, Value: ""}},
+		{name: "dimension is trimmed", part: " page ==/", want: Filter{Dimension: "page", Op: FilterEquals, Value: "/"}},
+		{name: "utm parameter", part: "utm_campaign==spring_sale", want: Filter{Dimension: "utm_campaign", Op: FilterEquals, Value: "spring_sale"}},
+		{name: "unknown utm parameter", part: "utm_id==42", wantErr: true},
+		{name: "unknown dimension", part: "visitor_ip==127.0.0.1", wantErr: true},
+		{name: "internal dimension", part: "referrer_host==google.com", wantErr: true},
+		{name: "missing dimension", part: "==/pricing", wantErr: true},
+		{name: "missing operator", part: "page", wantErr: true},
+		{name: "single equals", part: "page=/pricing", wantErr: true},
+		{name: "in is not accepted", part: "page in /", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFilter(tt.part)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFilter(%q) error = %v, wantErr %v", tt.part, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFilter(%q) = %+v, want %+v", tt.part, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    []Filter
+		wantErr bool
+	}{
+		{name: "empty", expr: "", want: nil},
+		{name: "single", expr: "page==/", want: []Filter{{Dimension: "page", Op: FilterEquals, Value: "/"}}},
+		{
+			name: "several",
+			expr: "page==/pricing;device==Mobile",
+			want: []Filter{
+				{Dimension: "page", Op: FilterEquals, Value: "/pricing"},
+				{Dimension: "device", Op: FilterEquals, Value: "Mobile"},
+			},
+		},
+		{
+			name: "empty parts are skipped",
+			expr: ";page==/;;device!=Desktop;",
+			want: []Filter{
+				{Dimension: "page", Op: FilterEquals, Value: "/"},
+				{Dimension: "device", Op: FilterNotEquals, Value: "Desktop"},
+			},
+		},
+		{name: "invalid part", expr: "page==/;browser", wantErr: true},
+		{name: "unknown dimension", expr: "page==/;planet==Mars", wantErr: true},
+		{name: "at the limit", expr: strings.Repeat("page==/;", maxFilters), want: repeatFilter(Filter{Dimension: "page", Op: FilterEquals, Value: "/"}, maxFilters)},
+		{name: "over the limit", expr: strings.Repeat("page==/;", maxFilters+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilters(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilters(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilters(%q) = %+v, want %+v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func repeatFilter(filter Filter, n int) []Filter {
+	filters := make([]Filter, n)
+	for i := range filters {
+		filters[i] = filter
+	}
+	return filters
+}
+
+func TestFilterSQL(t *testing.T) {
+	tests := []struct {
+		filter   Filter
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			filter:   Filter{Dimension: "page", Op: FilterEquals, Value: "/pricing"},
+			wantSQL:  "(cutQueryStringAndFragment(page)) = ?",
+			wantArgs: []any{"/pricing"},
+		},
+		{
+			filter:   Filter{Dimension: "referrer", Op: FilterNotEquals, Value: ""},
+			wantSQL:  "(referrer) != ?",
+			wantArgs: []any{""},
+		},
+		// contains and prefix match literally, so LIKE wildcards in the value
+		// are passed through untouched
+		{
+			filter:   Filter{Dimension: "page", Op: FilterContains, Value: `50%_off\`},
+			wantSQL:  "positionCaseInsensitive(cutQueryStringAndFragment(page), ?) > 0",
+			wantArgs: []any{`50%_off\`},
+		},
+		{
+			filter:   Filter{Dimension: "page", Op: FilterPrefix, Value: `/docs_v2/%`},
+			wantSQL:  "startsWith(cutQueryStringAndFragment(page), ?)",
+			wantArgs: []any{`/docs_v2/%`},
+		},
+		{
+			filter:   Filter{Dimension: "utm_source", Op: FilterEquals, Value: "newsletter"},
+			wantSQL:  "(decodeURLComponent(extractURLParameter(page, 'utm_source'))) = ?",
+			wantArgs: []any{"newsletter"},
+		},
+		{
+			filter:   Filter{Dimension: "utm_campaign", Op: FilterContains, Value: "100%"},
+			wantSQL:  "positionCaseInsensitive(decodeURLComponent(extractURLParameter(page, 'utm_campaign')), ?) > 0",
+			wantArgs: []any{"100%"},
+		},
+		{
+			filter:   Filter{Dimension: "utm_content", Op: FilterPrefix, Value: `hero_\`},
+			wantSQL:  "startsWith(decodeURLComponent(extractURLParameter(page, 'utm_content')), ?)",
+			wantArgs: []any{`hero_\`},
+		},
+		{
+			filter:   Filter{Dimension: "ip", Op: FilterIn, Values: []string{"10.0.0.1", "10.0.0.2"}},
+			wantSQL:  "visitor_ip IN (?, ?)",
+			wantArgs: []any{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			filter:  Filter{Dimension: "ip", Op: FilterIn},
+			wantSQL: "0",
+		},
+	}
+
+	for _, tt := range tests {
+		sql, args := tt.filter.sql()
+		if sql != tt.wantSQL {
+			t.Errorf("%+v: sql = %q, want %q", tt.filter, sql, tt.wantSQL)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%+v: args = %v, want %v", tt.filter, args, tt.wantArgs)
+		}
+	}
+}
+
+func TestWhereAllExclusions(t *testing.T) {
+	q := Query{
+		SiteID:        uuid.MustParse("7f1c0a52-7c1a-4d7e-9a4e-2f6f1f0f5b3e"),
+		Range:         TimeRange{From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)},
+		IncludeBots:   true,
+		ExcludedIPs:   []string{"10.0.0.0/8", "2001:db8::/32"},
+		ExcludedPaths: []string{"/admin/*"},
+	}
+
+	sql, args := q.whereAll()
+	wantSQL := strings.Join([]string{
+		"site_id = ?",
+		"created_on >= ?",
+		"created_on < ?",
+		"cutQueryStringAndFragment(page) NOT LIKE ?",
+		"NOT ((isIPv4String(trimBoth(visitor_ip)) OR isIPv6String(trimBoth(visitor_ip))) AND (" +
+			"isIPAddressInRange(IPv6NumToString(toIPv6(trimBoth(visitor_ip))), ?) OR " +
+			"isIPAddressInRange(IPv6NumToString(toIPv6(trimBoth(visitor_ip))), ?)))",
+	}, "\n\t\t  AND ")
+	if sql != wantSQL {
+		t.Errorf("whereAll() sql = %q, want %q", sql, wantSQL)
+	}
+
+	wantArgs := []any{q.SiteID.String(), q.Range.From, q.Range.To, "/admin/%", "::ffff:10.0.0.0/104", "2001:db8::/32"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("whereAll() args = %v, want %v", args, wantArgs)
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ThEditor/clutter-studio/internal/referrer"
+)
+
+// RealtimeWindow is how recently a visitor must have been seen to count as
+// currently on the site.
+const RealtimeWindow = 5 * time.Minute
+
+type RealtimePage struct {
+	Page     string `json:"page"`
+	Visitors int    `json:"visitors"`
+}
+
+type RealtimeReferrer struct {
+	Referrer string `json:"referrer"`
+	Channel  string `json:"channel"`
+	Visitors int    `json:"visitors"`
+}
+
+type RealtimeStats struct {
+	Time      time.Time          `json:"time"`
+	Visitors  int                `json:"visitors"`
+	Pages     []RealtimePage     `json:"pages"`
+	Referrers []RealtimeReferrer `json:"referrers"`
+}
+
+// GetRealtime returns the visitors seen within RealtimeWindow of now, with
+// the page each of them is currently on and where they came from. Filters
+// other than the site and time range are ignored.
+func (s *ClickHouseStorage) GetRealtime(q Query, now time.Time, limit int) (*RealtimeStats, error) {
+	q.Range = TimeRange{From: now.Add(-RealtimeWindow), To: now.Add(time.Second)}
+	where, args := q.where()
+	host, _ := dimensionExpr("referrer_host")
+
+	rows, err := s.db.Query(`
+		SELECT current_page, source_host, count(*) AS visitors
+		FROM (
+		  SELECT
+		    argMax(`+pagePathExpr+`, created_on) AS current_page,
+		    argMin(`+host+`, created_on) AS source_host
+		  FROM events
+		  WHERE `+where+`
+		  GROUP BY visitor_ip || visitor_user_agent
+		)
+		GROUP BY current_page, source_host
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get realtime visitors: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &RealtimeStats{Time: now}
+	pages := make(map[string]int)
+	referrers := make(map[referrer.Source]int)
+	for rows.Next() {
+		var page, host string
+		var visitors int
+		if err := rows.Scan(&page, &host, &visitors); err != nil {
+			return nil, fmt.Errorf("failed to scan realtime visitors: %w", err)
+		}
+
+		stats.Visitors += visitors
+		pages[page] += visitors
+		referrers[referrer.Classify(host, q.SiteDomains)] += visitors
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over realtime visitors: %w", err)
+	}
+
+	stats.Pages = make([]RealtimePage, 0, len(pages))
+	for page, visitors := range pages {
+		stats.Pages = append(stats.Pages, RealtimePage{Page: page, Visitors: visitors})
+	}
+	sort.Slice(stats.Pages, func(i, j int) bool {
+		if stats.Pages[i].Visitors != stats.Pages[j].Visitors {
+			return stats.Pages[i].Visitors > stats.Pages[j].Visitors
+		}
+		return stats.Pages[i].Page < stats.Pages[j].Page
+	})
+	stats.Pages = paginate(stats.Pages, limit, 0)
+
+	stats.Referrers = make([]RealtimeReferrer, 0, len(referrers))
+	for source, visitors := range referrers {
+		stats.Referrers = append(stats.Referrers, RealtimeReferrer{Referrer: source.Name, Channel: source.Channel, Visitors: visitors})
+	}
+	sort.Slice(stats.Referrers, func(i, j int) bool {
+		if stats.Referrers[i].Visitors != stats.Referrers[j].Visitors {
+			return stats.Referrers[i].Visitors > stats.Referrers[j].Visitors
+		}
+		return stats.Referrers[i].Referrer < stats.Referrers[j].Referrer
+	})
+	stats.Referrers = paginate(stats.Referrers, limit, 0)
+
+	return stats, nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+type RetentionPeriod struct {
+	Period   int     `json:"period"`
+	Visitors int     `json:"visitors"`
+	Rate     float64 `json:"rate"`
+}
+
+// RetentionCohort holds the visitors first seen in the bucket starting at
+// Cohort, and how many of them were seen again each following period.
+type RetentionCohort struct {
+	Cohort    time.Time         `json:"cohort"`
+	Visitors  int               `json:"visitors"`
+	Retention []RetentionPeriod `json:"retention"`
+}
+
+// periodsBetween counts the buckets of the granularity from one bucket start
+// to another, both in the same timezone.
+func periodsBetween(from time.Time, to time.Time, granularity Granularity) int {
+	// calendar days, so that days shortened or lengthened by daylight saving
+	// time still count as one
+	days := int(time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).
+		Sub(time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+
+	switch granularity {
+	case GranularityHour:
+		return int(to.Sub(from) / time.Hour)
+	case GranularityWeek:
+		return days / 7
+	case GranularityMonth:
+		return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	default:
+		return days
+	}
+}
+
+// retentionRow counts the visitors of a cohort seen in a bucket.
+type retentionRow struct {
+	cohort   time.Time
+	bucket   time.Time
+	visitors int
+}
+
+// GetRetention builds the cohort matrix of the query's range: visitors are
+// grouped by the bucket they were first seen in, and counted again in each
+// of the following periods they came back in. Visitors first seen before
+// the range belong to no cohort.
+func (s *ClickHouseStorage) GetRetention(q Query, granularity Granularity, periods int) ([]RetentionCohort, error) {
+	where, args := q.where()
+	loc := q.location()
+	bucket := bucketExpr(granularity, "created_on", loc)
+
+	// first seen looks back before the range, so that returning visitors
+	// aren't mistaken for new ones in the first cohort
+	history := q
+	history.Range.From = time.Unix(0, 0).UTC()
+	historyWhere, historyArgs := history.where()
+
+	rows, err := s.db.Query(`
+		SELECT
+		  first_seen.cohort AS cohort,
+		  activity.bucket AS bucket,
+		  uniqExact(activity.visitor) AS visitors
+		FROM (
+		  SELECT visitor_ip || visitor_user_agent AS visitor, `+bucket+` AS bucket
+		  FROM events
+		  WHERE `+where+`
+		  GROUP BY visitor, bucket
+		) AS activity
+		INNER JOIN (
+		  SELECT visitor_ip || visitor_user_agent AS visitor, min(`+bucket+`) AS cohort
+		  FROM events
+		  WHERE `+historyWhere+`
+		  GROUP BY visitor
+		  HAVING min(created_on) >= ?
+		) AS first_seen ON activity.visitor = first_seen.visitor
+		GROUP BY cohort, bucket
+	`, append(append(args, historyArgs...), q.Range.From)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []retentionRow
+	for rows.Next() {
+		var row retentionRow
+		if err := rows.Scan(&row.cohort, &row.bucket, &row.visitors); err != nil {
+			return nil, fmt.Errorf("failed to scan retention: %w", err)
+		}
+		counts = append(counts, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over retention: %w", err)
+	}
+
+	return retentionCohorts(q.Range, granularity, periods, loc, counts), nil
+}
+
+// retentionCohorts lays the counts out as one cohort per bucket of the
+// range, each followed for up to periods periods or until the range ends.
+func retentionCohorts(tr TimeRange, granularity Granularity, periods int, loc *time.Location, counts []retentionRow) []RetentionCohort {
+	cohorts := make(map[int64]*RetentionCohort)
+	for _, start := range GraphBuckets(tr, granularity, loc) {
+		cohort := &RetentionCohort{Cohort: start, Retention: make([]RetentionPeriod, 0, periods+1)}
+		for period := 0; period <= periods; period++ {
+			cohort.Retention = append(cohort.Retention, RetentionPeriod{Period: period})
+		}
+		cohorts[start.Unix()] = cohort
+	}
+
+	for _, row := range counts {
+		cohort, ok := cohorts[row.cohort.Unix()]
+		if !ok {
+			continue
+		}
+
+		period := periodsBetween(row.cohort.In(loc), row.bucket.In(loc), granularity)
+		if period < 0 || period > periods {
+			continue
+		}
+		cohort.Retention[period].Visitors = row.visitors
+	}
+
+	results := make([]RetentionCohort, 0, len(cohorts))
+	for _, start := range GraphBuckets(tr, granularity, loc) {
+		cohort := cohorts[start.Unix()]
+		cohort.Visitors = cohort.Retention[0].Visitors
+		for i := range cohort.Retention {
+			if cohort.Visitors > 0 {
+				cohort.Retention[i].Rate = roundTo2(float64(cohort.Retention[i].Visitors) * 100 / float64(cohort.Visitors))
+			}
+		}
+
+		// periods that have not happened yet are left out
+		elapsed := periodsBetween(start, tr.To.Add(-time.Second).In(loc), granularity)
+		if elapsed < periods {
+			cohort.Retention = cohort.Retention[:elapsed+1]
+		}
+
+		results = append(results, *cohort)
+	}
+	return results
+}
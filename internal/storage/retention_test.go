@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodsBetween(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, year int, month time.Month, day int, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name        string
+		from        time.Time
+		to          time.Time
+		granularity Granularity
+		want        int
+	}{
+		{"same day", at(time.UTC, 2024, 3, 4, 0), at(time.UTC, 2024, 3, 4, 0), GranularityDay, 0},
+		{"next day", at(time.UTC, 2024, 3, 4, 0), at(time.UTC, 2024, 3, 5, 0), GranularityDay, 1},
+		{"across a leap day", at(time.UTC, 2024, 2, 28, 0), at(time.UTC, 2024, 3, 1, 0), GranularityDay, 2},
+		{"short day", at(newYork, 2024, 3, 9, 0), at(newYork, 2024, 3, 11, 0), GranularityDay, 2},
+		{"long day", at(newYork, 2024, 11, 3, 0), at(newYork, 2024, 11, 4, 0), GranularityDay, 1},
+		{"hours", at(time.UTC, 2024, 3, 4, 22), at(time.UTC, 2024, 3, 5, 1), GranularityHour, 3},
+		{"hours across the fall change", at(newYork, 2024, 11, 3, 0), at(newYork, 2024, 11, 3, 3), GranularityHour, 4},
+		{"same week", at(time.UTC, 2024, 3, 4, 0), at(time.UTC, 2024, 3, 4, 0), GranularityWeek, 0},
+		{"next week", at(time.UTC, 2024, 3, 4, 0), at(time.UTC, 2024, 3, 11, 0), GranularityWeek, 1},
+		{"weeks across a year end", at(time.UTC, 2024, 12, 23, 0), at(time.UTC, 2025, 1, 6, 0), GranularityWeek, 2},
+		{"weeks across daylight saving time", at(newYork, 2024, 3, 4, 0), at(newYork, 2024, 3, 18, 0), GranularityWeek, 2},
+		{"next month", at(time.UTC, 2024, 1, 1, 0), at(time.UTC, 2024, 2, 1, 0), GranularityMonth, 1},
+		{"months across a year end", at(time.UTC, 2024, 11, 1, 0), at(time.UTC, 2025, 2, 1, 0), GranularityMonth, 3},
+		{"a year of months", at(time.UTC, 2024, 3, 1, 0), at(time.UTC, 2025, 3, 1, 0), GranularityMonth, 12},
+		{"backwards", at(time.UTC, 2024, 3, 1, 0), at(time.UTC, 2024, 2, 1, 0), GranularityMonth, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := periodsBetween(tt.from, tt.to, tt.granularity); got != tt.want {
+				t.Errorf("periodsBetween(%v, %v, %q) = %d, want %d", tt.from, tt.to, tt.granularity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionCohorts(t *testing.T) {
+	monday := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+
+	// three weeks starting on a Wednesday, so the first cohort starts before
+	// the range does and the last one is still running
+	tr := TimeRange{From: monday(3), To: monday(24)}
+	counts := []retentionRow{
+		{cohort: monday(1), bucket: monday(1), visitors: 10},
+		{cohort: monday(1), bucket: monday(8), visitors: 4},
+		{cohort: monday(1), bucket: monday(15), visitors: 3},
+		{cohort: monday(1), bucket: monday(22), visitors: 1},
+		{cohort: monday(8), bucket: monday(8), visitors: 5},
+		{cohort: monday(8), bucket: monday(22), visitors: 2},
+		// cohorts outside the range and periods past the limit are dropped
+		{cohort: monday(1).AddDate(0, 0, -7), bucket: monday(8), visitors: 7},
+		{cohort: monday(15), bucket: monday(15).AddDate(0, 0, 21), visitors: 9},
+	}
+
+	got := retentionCohorts(tr, GranularityWeek, 2, time.UTC, counts)
+
+	want := []struct {
+		cohort   time.Time
+		visitors int
+		periods  []int
+		rates    []float64
+	}{
+		{cohort: monday(1), visitors: 10, periods: []int{10, 4, 3}, rates: []float64{100, 40, 30}},
+		{cohort: monday(8), visitors: 5, periods: []int{5, 0, 2}, rates: []float64{100, 0, 40}},
+		{cohort: monday(15), visitors: 0, periods: []int{0, 0}, rates: []float64{0, 0}},
+		{cohort: monday(22), visitors: 0, periods: []int{0}, rates: []float64{0}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("retentionCohorts() returned %d cohorts, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		cohort := got[i]
+		if !cohort.Cohort.Equal(w.cohort) || cohort.Visitors != w.visitors {
+			t.Errorf("cohort %d = %v with %d visitors, want %v with %d", i, cohort.Cohort, cohort.Visitors, w.cohort, w.visitors)
+		}
+		if len(cohort.Retention) != len(w.periods) {
+			t.Errorf("cohort %d has %d periods, want %d", i, len(cohort.Retention), len(w.periods))
+			continue
+		}
+		for period, retention := range cohort.Retention {
+			if retention.Period != period || retention.Visitors != w.periods[period] || retention.Rate != w.rates[period] {
+				t.Errorf("cohort %d period %d = %+v, want %d visitors at %v%%", i, period, retention, w.periods[period], w.rates[period])
+			}
+		}
+	}
+}
+
+func TestRetentionCohortsMonthly(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 1, 0, 0, 0, 0, newYork) }
+
+	// counts come back from ClickHouse in UTC
+	tr := TimeRange{From: month(1), To: month(4)}
+	counts := []retentionRow{
+		{cohort: month(1).UTC(), bucket: month(1).UTC(), visitors: 8},
+		{cohort: month(1).UTC(), bucket: month(3).UTC(), visitors: 2},
+		{cohort: month(3).UTC(), bucket: month(3).UTC(), visitors: 3},
+	}
+
+	got := retentionCohorts(tr, GranularityMonth, 6, newYork, counts)
+	if len(got) != 3 {
+		t.Fatalf("retentionCohorts() returned %d cohorts, want 3: %+v", len(got), got)
+	}
+	if periods := len(got[0].Retention); periods != 3 {
+		t.Errorf("January cohort has %d periods, want 3", periods)
+	}
+	if r := got[0].Retention[2]; r.Visitors != 2 || r.Rate != 25 {
+		t.Errorf("January cohort in March = %+v, want 2 visitors at 25%%", r)
+	}
+	if got[1].Visitors != 0 || len(got[1].Retention) != 2 {
+		t.Errorf("February cohort = %+v, want no visitors over 2 periods", got[1])
+	}
+	if got[2].Visitors != 3 || len(got[2].Retention) != 1 {
+		t.Errorf("March cohort = %+v, want 3 visitors over 1 period", got[2])
+	}
+}
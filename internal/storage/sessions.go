@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultSessionTimeout is the inactivity gap after which a visitor's next
+// event starts a new visit.
+const DefaultSessionTimeout = 30 * time.Minute
+
+type SessionStats struct {
+	Visits        int     `json:"visits"`
+	BounceRate    float64 `json:"bounce_rate"`
+	VisitDuration float64 `json:"visit_duration"`
+	PagesPerVisit float64 `json:"pages_per_visit"`
+}
+
+// BreakdownStats are the session metrics of the visits whose first event had
+// Value as its dimension.
+type BreakdownStats struct {
+	Value     string `json:"value"`
+	Visitors  int    `json:"visitors"`
+	PageViews int    `json:"page_views"`
+	SessionStats
+}
+
+// sessionStatsColumns computes SessionStats over the rows of sessions().
+const sessionStatsColumns = `
+		  count(*) AS visits,
+		  if(count(*) = 0, 0, round(countIf(pageviews = 1) * 100 / count(*), 2)) AS bounce_rate,
+		  if(count(*) = 0, 0, round(avg(dateDiff('second', session_start, session_end)), 2)) AS visit_duration,
+		  if(count(*) = 0, 0, round(avg(pageviews), 2)) AS pages_per_visit`
+
+// IsBreakdownDimension reports whether analytics can be broken down by the
+// named dimension.
+func IsBreakdownDimension(dimension string) bool {
+	if _, ok := classifiedDimensions[dimension]; ok {
+		return true
+	}
+	_, ok := filterDimensions[dimension]
+	return ok
+}
+
+// sessionTimeout returns the query's session timeout in seconds.
+func (q Query) sessionTimeout() int {
+	if q.SessionTimeout <= 0 {
+		return int(DefaultSessionTimeout.Seconds())
+	}
+	return int(q.SessionTimeout.Seconds())
+}
+
+// sessions renders a subquery with one row per visit, a visit being the
+// events of a visitor without a gap longer than the session timeout between
+// them. When dimension is set, each visit also carries the value of that
+// dimension on its first event.
+//
+// Visits are built from all of the visitor's pageviews and the filters then
+// keep the visits with at least one matching pageview, so that the filters
+// don't cut visits short and skew their metrics, entry and exit pages.
+func (q Query) sessions(dimension string) (string, []any) {
+	unfiltered := q
+	unfiltered.Filters = nil
+	where, whereArgs := unfiltered.where()
+
+	matchExpr := "1"
+	var matchArgs []any
+	if len(q.Filters) > 0 {
+		conditions := make([]string, 0, len(q.Filters))
+		for _, filter := range q.Filters {
+			condition, filterArgs := filter.sql()
+			conditions = append(conditions, condition)
+			matchArgs = append(matchArgs, filterArgs...)
+		}
+		matchExpr = "(" + strings.Join(conditions, " AND ") + ")"
+	}
+
+	valueExpr := "''"
+	if expr, ok := dimensionExpr(dimension); ok {
+		valueExpr = expr
+	}
+
+	args := append([]any{q.sessionTimeout()}, matchArgs...)
+	args = append(args, whereArgs...)
+
+	return `
+		SELECT
+		  visitor,
+		  min(created_on) AS session_start,
+		  max(created_on) AS session_end,
+		  count(*) AS pageviews,
+		  argMin(path, created_on) AS entry_page,
+		  argMax(path, created_on) AS exit_page,
+		  argMin(dimension_value, created_on) AS dimension
+		FROM (
+		  SELECT
+		    visitor,
+		    created_on,
+		    path,
+		    dimension_value,
+		    matches_filters,
+		    sum(is_new_session) OVER (PARTITION BY visitor ORDER BY created_on ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS session_index
+		  FROM (
+		    SELECT
+		      visitor_ip || visitor_user_agent AS visitor,
+		      created_on,
+		      ` + pagePathExpr + ` AS path,
+		      ` + valueExpr + ` AS dimension_value,
+		      dateDiff('second', lagInFrame(created_on) OVER (PARTITION BY visitor ORDER BY created_on ROWS BETWEEN 1 PRECEDING AND CURRENT ROW), created_on) > ? AS is_new_session,
+		      ` + matchExpr + ` AS matches_filters
+		    FROM events
+		    WHERE ` + where + `
+		  )
+		)
+		GROUP BY visitor, session_index
+		HAVING countIf(matches_filters) > 0
+	`, args
+}
+
+// GetSessionStats returns the visit metrics of the query.
+func (s *ClickHouseStorage) GetSessionStats(q Query) (SessionStats, error) {
+	sessions, args := q.sessions("")
+
+	var stats SessionStats
+	err := s.db.QueryRow(`
+		SELECT`+sessionStatsColumns+`
+		FROM (`+sessions+`)
+	`, args...).Scan(&stats.Visits, &stats.BounceRate, &stats.VisitDuration, &stats.PagesPerVisit)
+	if err != nil {
+		return SessionStats{}, fmt.Errorf("failed to get session stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetSessionBreakdown returns the visit metrics grouped by the value the
+// dimension had when each visit started, most visited first.
+func (s *ClickHouseStorage) GetSessionBreakdown(q Query, dimension string, limit int, offset int) ([]BreakdownStats, error) {
+	if _, ok := classifiedDimensions[dimension]; ok {
+		return s.getClassifiedBreakdown(q, dimension, limit, offset)
+	}
+
+	if _, ok := filterDimensions[dimension]; !ok {
+		return nil, fmt.Errorf("unknown breakdown dimension %q", dimension)
+	}
+
+	return s.querySessionBreakdown(q, dimension, limit, offset)
+}
+
+// querySessionBreakdown groups the visits by a dimension compiled to SQL,
+// returning every group when limit is not positive.
+func (s *ClickHouseStorage) querySessionBreakdown(q Query, dimension string, limit int, offset int) ([]BreakdownStats, error) {
+	sessions, args := q.sessions(dimension)
+
+	pagination := ""
+	if limit > 0 {
+		pagination = "LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT
+		  dimension,
+		  uniqExact(visitor) AS visitors,
+		  sum(pageviews) AS page_views,`+sessionStatsColumns+`
+		FROM (`+sessions+`)
+		GROUP BY dimension
+		ORDER BY visits DESC, dimension
+		`+pagination+`
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]BreakdownStats, 0)
+	for rows.Next() {
+		var stats BreakdownStats
+		if err := rows.Scan(&stats.Value, &stats.Visitors, &stats.PageViews, &stats.Visits, &stats.BounceRate, &stats.VisitDuration, &stats.PagesPerVisit); err != nil {
+			return nil, fmt.Errorf("failed to scan session breakdown: %w", err)
+		}
+		results = append(results, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over session breakdown: %w", err)
+	}
+
+	return results, nil
+}
+
+type EntryPageStats struct {
+	Page       string  `json:"page"`
+	Visitors   int     `json:"visitors"`
+	Visits     int     `json:"visits"`
+	BounceRate float64 `json:"bounce_rate"`
+}
+
+type ExitPageStats struct {
+	Page      string  `json:"page"`
+	Visits    int     `json:"visits"`
+	PageViews int     `json:"page_views"`
+	ExitRate  float64 `json:"exit_rate"`
+}
+
+// GetEntryPages returns the pages visits started on, most visits first.
+func (s *ClickHouseStorage) GetEntryPages(q Query, limit int, offset int) ([]EntryPageStats, error) {
+	sessions, args := q.sessions("")
+	rows, err := s.db.Query(`
+		SELECT
+		  entry_page,
+		  uniqExact(visitor) AS visitors,
+		  count(*) AS visits,
+		  round(countIf(pageviews = 1) * 100 / count(*), 2) AS bounce_rate
+		FROM (`+sessions+`)
+		GROUP BY entry_page
+		ORDER BY visits DESC, entry_page
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entry pages: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]EntryPageStats, 0)
+	for rows.Next() {
+		var stats EntryPageStats
+		if err := rows.Scan(&stats.Page, &stats.Visitors, &stats.Visits, &stats.BounceRate); err != nil {
+			return nil, fmt.Errorf("failed to scan entry page stats: %w", err)
+		}
+		results = append(results, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over entry page stats: %w", err)
+	}
+	return results, nil
+}
+
+// GetExitPages returns the pages visits ended on, most visits first. The exit
+// rate is the share of the page's views that were the last of their visit,
+// out of all of the page's views as filtered visits may exit on any page.
+func (s *ClickHouseStorage) GetExitPages(q Query, limit int, offset int) ([]ExitPageStats, error) {
+	sessions, args := q.sessions("")
+	unfiltered := q
+	unfiltered.Filters = nil
+	where, whereArgs := unfiltered.where()
+	args = append(args, whereArgs...)
+
+	rows, err := s.db.Query(`
+		SELECT
+		  exits.page AS page,
+		  exits.visits AS visits,
+		  views.page_views AS page_views,
+		  round(exits.visits * 100 / views.page_views, 2) AS exit_rate
+		FROM (
+		  SELECT exit_page AS page, count(*) AS visits
+		  FROM (`+sessions+`)
+		  GROUP BY page
+		) AS exits
+		INNER JOIN (
+		  SELECT `+pagePathExpr+` AS path, count(*) AS page_views
+		  FROM events
+		  WHERE `+where+`
+		  GROUP BY path
+		) AS views ON exits.page = views.path
+		ORDER BY visits DESC, page
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exit pages: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]ExitPageStats, 0)
+	for rows.Next() {
+		var stats ExitPageStats
+		if err := rows.Scan(&stats.Page, &stats.Visits, &stats.PageViews, &stats.ExitRate); err != nil {
+			return nil, fmt.Errorf("failed to scan exit page stats: %w", err)
+		}
+		results = append(results, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over exit page stats: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// compact collapses the whitespace of a query so that tests don't depend on
+// its indentation.
+func compact(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func TestSessionsFiltersWholeVisits(t *testing.T) {
+	q := Query{
+		SiteID:         uuid.MustParse("3b0e6f5c-2d1a-4c7b-8e9f-0a1b2c3d4e5f"),
+		Range:          TimeRange{From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+		SessionTimeout: 15 * time.Minute,
+		IncludeBots:    true,
+		Filters: []Filter{
+			{Dimension: "page", Op: FilterEquals, Value: "/pricing"},
+			{Dimension: "utm_source", Op: FilterNotEquals, Value: "newsletter"},
+		},
+	}
+
+	sql, args := q.sessions("referrer")
+	want := compact(`
+		SELECT
+		  visitor,
+		  min(created_on) AS session_start,
+		  max(created_on) AS session_end,
+		  count(*) AS pageviews,
+		  argMin(path, created_on) AS entry_page,
+		  argMax(path, created_on) AS exit_page,
+		  argMin(dimension_value, created_on) AS dimension
+		FROM (
+		  SELECT
+		    visitor,
+		    created_on,
+		    path,
+		    dimension_value,
+		    matches_filters,
+		    sum(is_new_session) OVER (PARTITION BY visitor ORDER BY created_on ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS session_index
+		  FROM (
+		    SELECT
+		      visitor_ip || visitor_user_agent AS visitor,
+		      created_on,
+		      cutQueryStringAndFragment(page) AS path,
+		      referrer AS dimension_value,
+		      dateDiff('second', lagInFrame(created_on) OVER (PARTITION BY visitor ORDER BY created_on ROWS BETWEEN 1 PRECEDING AND CURRENT ROW), created_on) > ? AS is_new_session,
+		      ((cutQueryStringAndFragment(page)) = ? AND (decodeURLComponent(extractURLParameter(page, 'utm_source'))) != ?) AS matches_filters
+		    FROM events
+		    WHERE event_name = 'pageview'
+		      AND site_id = ?
+		      AND created_on >= ?
+		      AND created_on < ?
+		  )
+		)
+		GROUP BY visitor, session_index
+		HAVING countIf(matches_filters) > 0
+	`)
+	if got := compact(sql); got != want {
+		t.Errorf("sessions() =\n%s\nwant\n%s", got, want)
+	}
+
+	wantArgs := []any{900, "/pricing", "newsletter", q.SiteID.String(), q.Range.From, q.Range.To}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("sessions() args = %v, want %v", args, wantArgs)
+	}
+
+	// without filters every visit is kept
+	q.Filters = nil
+	sql, args = q.sessions("")
+	if !strings.Contains(compact(sql), "> ? AS is_new_session, 1 AS matches_filters") {
+		t.Errorf("sessions() without filters = %s, want matches_filters to be 1", compact(sql))
+	}
+	if len(args) != 4 {
+		t.Errorf("sessions() without filters has %d args, want 4", len(args))
+	}
+}
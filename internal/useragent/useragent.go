@@ -0,0 +1,135 @@
+// Package useragent classifies User-Agent headers into browser, operating
+// system and device class using an offline rule set.
+package useragent
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ThEditor/clutter-studio/internal/bots"
+)
+
+const Unknown = "Unknown"
+
+const (
+	DeviceDesktop = "Desktop"
+	DeviceMobile  = "Mobile"
+	DeviceTablet  = "Tablet"
+	DeviceBot     = "Bot"
+)
+
+type UserAgent struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version"`
+	OS             string `json:"os"`
+	OSVersion      string `json:"os_version"`
+	Device         string `json:"device"`
+	Bot            bool   `json:"bot"`
+}
+
+// rule matches a product token, the first submatch being its version.
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// browserRules are checked in order, so browsers built on Chromium or WebKit
+// come before the engines whose tokens they also send.
+var browserRules = []rule{
+	{"Edge", regexp.MustCompile(`(?:Edg|Edge|EdgA|EdgiOS)/(\d+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera|OPiOS)/(\d+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/(\d+)`)},
+	{"UC Browser", regexp.MustCompile(`UCBrowser/(\d+)`)},
+	{"Yandex Browser", regexp.MustCompile(`YaBrowser/(\d+)`)},
+	{"Vivaldi", regexp.MustCompile(`Vivaldi/(\d+)`)},
+	{"DuckDuckGo", regexp.MustCompile(`DuckDuckGo/(\d+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)},
+	{"Chrome", regexp.MustCompile(`(?:HeadlessChrome|Chrome|CriOS)/(\d+)`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)(\d+)`)},
+	{"Safari", regexp.MustCompile(`Version/(\d+).*Safari/`)},
+	{"Safari", regexp.MustCompile(`(?:iPhone|iPad|iPod|Macintosh).*AppleWebKit/()`)},
+}
+
+var osRules = []rule{
+	{"Windows Phone", regexp.MustCompile(`Windows Phone(?: OS)? (\d+(?:\.\d+)?)`)},
+	{"Windows", regexp.MustCompile(`Windows NT (\d+\.\d+)`)},
+	{"iOS", regexp.MustCompile(`(?:iPhone|iPad|iPod).*? OS (\d+(?:_\d+)?)`)},
+	{"Android", regexp.MustCompile(`Android (\d+(?:\.\d+)?)`)},
+	{"Chrome OS", regexp.MustCompile(`CrOS \S+ (\d+)`)},
+	{"macOS", regexp.MustCompile(`Mac OS X (\d+(?:[_.]\d+)?)`)},
+	{"Linux", regexp.MustCompile(`Linux()`)},
+}
+
+// windowsVersions maps Windows NT kernel versions to their marketing names.
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.2":  "XP",
+	"5.1":  "XP",
+}
+
+var tabletPattern = regexp.MustCompile(`(?i)iPad|Tablet|Kindle|Silk/|PlayBook`)
+
+var mobilePattern = regexp.MustCompile(`(?i)Mobi|iPhone|iPod|Windows Phone|Opera Mini`)
+
+// Parse classifies a User-Agent header. Parts that cannot be recognized are
+// reported as Unknown.
+func Parse(ua string) UserAgent {
+	result := UserAgent{
+		Browser:        Unknown,
+		BrowserVersion: Unknown,
+		OS:             Unknown,
+		OSVersion:      Unknown,
+		Device:         DeviceDesktop,
+		Bot:            IsBot(ua),
+	}
+
+	for _, r := range browserRules {
+		if match := r.pattern.FindStringSubmatch(ua); match != nil {
+			result.Browser = r.name
+			if match[1] != "" {
+				result.BrowserVersion = r.name + " " + match[1]
+			}
+			break
+		}
+	}
+
+	for _, r := range osRules {
+		if match := r.pattern.FindStringSubmatch(ua); match != nil {
+			result.OS = r.name
+			if version := osVersion(r.name, match[1]); version != "" {
+				result.OSVersion = r.name + " " + version
+			}
+			break
+		}
+	}
+
+	switch {
+	case result.Bot:
+		result.Device = DeviceBot
+	case tabletPattern.MatchString(ua), result.OS == "Android" && !strings.Contains(ua, "Mobile"):
+		result.Device = DeviceTablet
+	case mobilePattern.MatchString(ua):
+		result.Device = DeviceMobile
+	}
+
+	return result
+}
+
+// IsBot reports whether the User-Agent belongs to a crawler, a headless
+// browser or an HTTP library.
+func IsBot(ua string) bool {
+	return bots.ClassifyUserAgent(ua) != ""
+}
+
+// osVersion normalizes the version captured by an OS rule.
+func osVersion(os string, version string) string {
+	version = strings.ReplaceAll(version, "_", ".")
+	if os == "Windows" {
+		return windowsVersions[version]
+	}
+	return strings.TrimSuffix(version, ".0")
+}
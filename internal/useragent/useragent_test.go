@@ -0,0 +1,105 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want UserAgent
+	}{
+		{
+			name: "chrome on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: UserAgent{Browser: "Chrome", BrowserVersion: "Chrome 120", OS: "Windows", OSVersion: "Windows 10", Device: DeviceDesktop},
+		},
+		{
+			name: "edge before chrome",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.61",
+			want: UserAgent{Browser: "Edge", BrowserVersion: "Edge 120", OS: "Windows", OSVersion: "Windows 10", Device: DeviceDesktop},
+		},
+		{
+			name: "internet explorer",
+			ua:   "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			want: UserAgent{Browser: "Internet Explorer", BrowserVersion: "Internet Explorer 11", OS: "Windows", OSVersion: "Windows 7", Device: DeviceDesktop},
+		},
+		{
+			name: "safari on macos",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+			want: UserAgent{Browser: "Safari", BrowserVersion: "Safari 17", OS: "macOS", OSVersion: "macOS 10.15", Device: DeviceDesktop},
+		},
+		{
+			name: "firefox on macos",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.0; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: UserAgent{Browser: "Firefox", BrowserVersion: "Firefox 121", OS: "macOS", OSVersion: "macOS 14", Device: DeviceDesktop},
+		},
+		{
+			name: "firefox on linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: UserAgent{Browser: "Firefox", BrowserVersion: "Firefox 121", OS: "Linux", OSVersion: Unknown, Device: DeviceDesktop},
+		},
+		{
+			name: "chrome on chrome os",
+			ua:   "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: UserAgent{Browser: "Chrome", BrowserVersion: "Chrome 120", OS: "Chrome OS", OSVersion: "Chrome OS 14541", Device: DeviceDesktop},
+		},
+		{
+			name: "safari on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want: UserAgent{Browser: "Safari", BrowserVersion: "Safari 17", OS: "iOS", OSVersion: "iOS 17.1", Device: DeviceMobile},
+		},
+		{
+			name: "chrome on ipad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/119.0.6045.109 Mobile/15E148 Safari/604.1",
+			want: UserAgent{Browser: "Chrome", BrowserVersion: "Chrome 119", OS: "iOS", OSVersion: "iOS 17.1", Device: DeviceTablet},
+		},
+		{
+			name: "chrome on android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want: UserAgent{Browser: "Chrome", BrowserVersion: "Chrome 120", OS: "Android", OSVersion: "Android 14", Device: DeviceMobile},
+		},
+		{
+			name: "android without mobile token is a tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X200) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: UserAgent{Browser: "Chrome", BrowserVersion: "Chrome 120", OS: "Android", OSVersion: "Android 13", Device: DeviceTablet},
+		},
+		{
+			name: "samsung internet before chrome",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SAMSUNG SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			want: UserAgent{Browser: "Samsung Internet", BrowserVersion: "Samsung Internet 23", OS: "Android", OSVersion: "Android 13", Device: DeviceMobile},
+		},
+		{
+			name: "windows phone before android",
+			ua:   "Mozilla/5.0 (Windows Phone 10.0; Android 6.0.1; Microsoft; Lumia 950) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.116 Mobile Safari/537.36 Edge/15.15063",
+			want: UserAgent{Browser: "Edge", BrowserVersion: "Edge 15", OS: "Windows Phone", OSVersion: "Windows Phone 10", Device: DeviceMobile},
+		},
+		{
+			name: "crawler",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: UserAgent{Browser: Unknown, BrowserVersion: Unknown, OS: Unknown, OSVersion: Unknown, Device: DeviceBot, Bot: true},
+		},
+		{
+			name: "headless browser",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+			want: UserAgent{Browser: "Chrome", BrowserVersion: "Chrome 120", OS: "Linux", OSVersion: Unknown, Device: DeviceBot, Bot: true},
+		},
+		{
+			name: "http library",
+			ua:   "curl/8.4.0",
+			want: UserAgent{Browser: Unknown, BrowserVersion: Unknown, OS: Unknown, OSVersion: Unknown, Device: DeviceBot, Bot: true},
+		},
+		{
+			name: "empty",
+			ua:   "",
+			want: UserAgent{Browser: Unknown, BrowserVersion: Unknown, OS: Unknown, OSVersion: Unknown, Device: DeviceBot, Bot: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.ua); got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_password_reset_tokens_user_id;
+
+DROP TABLE IF EXISTS PasswordResetTokens;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_sessions_previous_refresh_token_hash;
+DROP INDEX IF EXISTS idx_sessions_user_id;
+
+DROP TABLE IF EXISTS Sessions;
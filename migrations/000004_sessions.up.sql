@@ -0,0 +1,16 @@
+CREATE TABLE Sessions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL,
+  refresh_token_hash VARCHAR(64) NOT NULL UNIQUE,
+  previous_refresh_token_hash VARCHAR(64),
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip_address VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_user_id ON Sessions(user_id);
+CREATE INDEX idx_sessions_previous_refresh_token_hash ON Sessions(previous_refresh_token_hash);
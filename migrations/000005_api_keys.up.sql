@@ -0,0 +1,15 @@
+CREATE TABLE ApiKeys (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  key_hash VARCHAR(64) NOT NULL UNIQUE,
+  scope VARCHAR(32) NOT NULL,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE,
+  CONSTRAINT valid_api_key_scope CHECK (scope IN ('read-only', 'sites:write'))
+);
+
+CREATE INDEX idx_api_keys_user_id ON ApiKeys(user_id);
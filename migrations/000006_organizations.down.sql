@@ -0,0 +1,15 @@
+ALTER TABLE Sites
+DROP CONSTRAINT IF EXISTS unique_organization_site_url;
+
+ALTER TABLE Sites
+ADD CONSTRAINT unique_user_site_url UNIQUE (user_id, site_url);
+
+DROP INDEX IF EXISTS idx_sites_organization_id;
+
+ALTER TABLE Sites
+DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_organization_members_user_id;
+
+DROP TABLE IF EXISTS OrganizationMembers;
+DROP TABLE IF EXISTS Organizations;
@@ -0,0 +1,46 @@
+CREATE TABLE Organizations (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  name VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE OrganizationMembers (
+  organization_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  role VARCHAR(16) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (organization_id, user_id),
+  FOREIGN KEY (organization_id) REFERENCES Organizations(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE,
+  CONSTRAINT valid_organization_role CHECK (role IN ('owner', 'admin', 'viewer'))
+);
+
+CREATE INDEX idx_organization_members_user_id ON OrganizationMembers(user_id);
+
+ALTER TABLE Sites
+ADD COLUMN organization_id UUID REFERENCES Organizations(id);
+
+-- every user that already owns sites gets a personal organization holding
+-- them, reusing the user id as the organization id
+INSERT INTO Organizations (id, name, created_at, updated_at)
+SELECT id, username, NOW(), NOW()
+FROM Users
+WHERE id IN (SELECT user_id FROM Sites);
+
+INSERT INTO OrganizationMembers (organization_id, user_id, role, created_at)
+SELECT id, id, 'owner', NOW()
+FROM Organizations;
+
+UPDATE Sites SET organization_id = user_id;
+
+ALTER TABLE Sites
+ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX idx_sites_organization_id ON Sites(organization_id);
+
+ALTER TABLE Sites
+DROP CONSTRAINT IF EXISTS unique_user_site_url;
+
+ALTER TABLE Sites
+ADD CONSTRAINT unique_organization_site_url UNIQUE (organization_id, site_url);
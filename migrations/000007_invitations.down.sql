@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_invitations_organization_id;
+DROP INDEX IF EXISTS idx_invitations_site_id;
+DROP INDEX IF EXISTS idx_invitations_email;
+
+DROP TABLE IF EXISTS Invitations;
+
+DROP INDEX IF EXISTS idx_site_members_user_id;
+
+DROP TABLE IF EXISTS SiteMembers;
@@ -0,0 +1,33 @@
+CREATE TABLE SiteMembers (
+  site_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  role VARCHAR(16) NOT NULL DEFAULT 'viewer',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (site_id, user_id),
+  FOREIGN KEY (site_id) REFERENCES Sites(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE,
+  CONSTRAINT valid_site_member_role CHECK (role IN ('viewer'))
+);
+
+CREATE INDEX idx_site_members_user_id ON SiteMembers(user_id);
+
+CREATE TABLE Invitations (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  email VARCHAR(255) NOT NULL,
+  site_id UUID,
+  organization_id UUID,
+  role VARCHAR(16) NOT NULL,
+  token_hash VARCHAR(64) NOT NULL UNIQUE,
+  invited_by UUID NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (site_id) REFERENCES Sites(id) ON DELETE CASCADE,
+  FOREIGN KEY (organization_id) REFERENCES Organizations(id) ON DELETE CASCADE,
+  FOREIGN KEY (invited_by) REFERENCES Users(id) ON DELETE CASCADE,
+  CONSTRAINT invitation_single_target CHECK ((site_id IS NULL) <> (organization_id IS NULL)),
+  CONSTRAINT valid_invitation_role CHECK (role IN ('owner', 'admin', 'viewer'))
+);
+
+CREATE INDEX idx_invitations_email ON Invitations(email);
+CREATE INDEX idx_invitations_site_id ON Invitations(site_id);
+CREATE INDEX idx_invitations_organization_id ON Invitations(organization_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_shared_links_site_id;
+
+DROP TABLE IF EXISTS SharedLinks;
@@ -0,0 +1,13 @@
+CREATE TABLE SharedLinks (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  site_id UUID NOT NULL,
+  slug VARCHAR(64) NOT NULL UNIQUE,
+  passHash VARCHAR(255),
+  expires_at TIMESTAMPTZ,
+  created_by UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (site_id) REFERENCES Sites(id) ON DELETE CASCADE,
+  FOREIGN KEY (created_by) REFERENCES Users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_shared_links_site_id ON SharedLinks(site_id);
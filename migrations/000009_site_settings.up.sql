@@ -0,0 +1,7 @@
+CREATE TABLE SiteSettings (
+  site_id UUID PRIMARY KEY,
+  session_timeout_minutes INTEGER NOT NULL DEFAULT 30,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (site_id) REFERENCES Sites(id) ON DELETE CASCADE,
+  CONSTRAINT valid_session_timeout CHECK (session_timeout_minutes BETWEEN 1 AND 1440)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_goals_site_id;
+
+DROP TABLE IF EXISTS Goals;
@@ -0,0 +1,13 @@
+CREATE TABLE Goals (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  site_id UUID NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  pattern VARCHAR(2048) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (site_id) REFERENCES Sites(id) ON DELETE CASCADE,
+  CONSTRAINT unique_site_goal_name UNIQUE (site_id, name),
+  CONSTRAINT valid_goal_kind CHECK (kind IN ('event', 'page'))
+);
+
+CREATE INDEX idx_goals_site_id ON Goals(site_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_funnels_site_id;
+
+DROP TABLE IF EXISTS Funnels;
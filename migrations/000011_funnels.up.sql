@@ -0,0 +1,13 @@
+CREATE TABLE Funnels (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  site_id UUID NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  window_minutes INTEGER NOT NULL DEFAULT 1440,
+  steps JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  FOREIGN KEY (site_id) REFERENCES Sites(id) ON DELETE CASCADE,
+  CONSTRAINT valid_funnel_window CHECK (window_minutes BETWEEN 1 AND 43200)
+);
+
+CREATE INDEX idx_funnels_site_id ON Funnels(site_id);
@@ -0,0 +1,4 @@
+ALTER TABLE SiteSettings
+  DROP COLUMN IF EXISTS excluded_paths,
+  DROP COLUMN IF EXISTS excluded_ips,
+  DROP COLUMN IF EXISTS timezone;
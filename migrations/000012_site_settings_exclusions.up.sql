@@ -0,0 +1,4 @@
+ALTER TABLE SiteSettings
+  ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC',
+  ADD COLUMN excluded_ips TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN excluded_paths TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,7 @@
+CREATE TABLE SiteDomains (
+  site_id UUID NOT NULL,
+  domain VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (site_id, domain),
+  FOREIGN KEY (site_id) REFERENCES Sites(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS unique_site_primary_domain;
+DROP INDEX IF EXISTS unique_site_domain;
+
+-- primary domains are kept as aliases, which may predate this migration
+ALTER TABLE SiteDomains DROP COLUMN IF EXISTS is_primary;
@@ -0,0 +1,32 @@
+ALTER TABLE SiteDomains ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- every domain must belong to a single site, either as its URL or an alias;
+-- detach the duplicates by hand rather than guessing which site keeps them
+DO $$
+DECLARE
+  duplicates TEXT;
+BEGIN
+  SELECT string_agg(domain, ', ' ORDER BY domain) INTO duplicates
+  FROM (
+    SELECT domain
+    FROM (
+      SELECT id AS site_id, site_url AS domain FROM Sites
+      UNION
+      SELECT site_id, domain FROM SiteDomains
+    ) AS all_domains
+    GROUP BY domain
+    HAVING COUNT(DISTINCT site_id) > 1
+  ) AS shared;
+
+  IF duplicates IS NOT NULL THEN
+    RAISE EXCEPTION 'domains used by several sites: %', duplicates;
+  END IF;
+END $$;
+
+INSERT INTO SiteDomains (site_id, domain, is_primary, created_at)
+SELECT id, site_url, TRUE, created_at
+FROM Sites
+ON CONFLICT (site_id, domain) DO UPDATE SET is_primary = TRUE;
+
+CREATE UNIQUE INDEX unique_site_domain ON SiteDomains(domain);
+CREATE UNIQUE INDEX unique_site_primary_domain ON SiteDomains(site_id) WHERE is_primary;
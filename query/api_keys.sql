@@ -0,0 +1,35 @@
+-- name: CreateAPIKey :one
+INSERT INTO ApiKeys (id, user_id, name, prefix, key_hash, scope, created_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, $4, $5, now())
+RETURNING *;
+
+-- name: FindActiveAPIKeyByHash :one
+SELECT * FROM ApiKeys
+WHERE key_hash = $1
+AND revoked_at IS NULL;
+
+-- name: ListActiveAPIKeysByUserID :many
+SELECT * FROM ApiKeys
+WHERE user_id = $1
+AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RenameAPIKey :one
+UPDATE ApiKeys
+SET name = $1
+WHERE id = $2
+AND user_id = $3
+AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeAPIKey :execrows
+UPDATE ApiKeys
+SET revoked_at = now()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
+
+-- name: UpdateAPIKeyLastUsed :exec
+UPDATE ApiKeys
+SET last_used_at = now()
+WHERE id = $1;
@@ -0,0 +1,23 @@
+-- name: CreateFunnel :one
+INSERT INTO Funnels (id, site_id, name, window_minutes, steps, created_at, updated_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, $4, now(), now())
+RETURNING *;
+
+-- name: FindFunnelByID :one
+SELECT * FROM Funnels
+WHERE id = $1 AND site_id = $2;
+
+-- name: ListFunnelsBySiteID :many
+SELECT * FROM Funnels
+WHERE site_id = $1
+ORDER BY created_at;
+
+-- name: UpdateFunnel :one
+UPDATE Funnels
+SET name = $3, window_minutes = $4, steps = $5, updated_at = now()
+WHERE id = $1 AND site_id = $2
+RETURNING *;
+
+-- name: DeleteFunnel :execrows
+DELETE FROM Funnels
+WHERE id = $1 AND site_id = $2;
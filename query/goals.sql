@@ -0,0 +1,13 @@
+-- name: CreateGoal :one
+INSERT INTO Goals (id, site_id, name, kind, pattern, created_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, $4, now())
+RETURNING *;
+
+-- name: ListGoalsBySiteID :many
+SELECT * FROM Goals
+WHERE site_id = $1
+ORDER BY created_at;
+
+-- name: DeleteGoal :execrows
+DELETE FROM Goals
+WHERE id = $1 AND site_id = $2;
@@ -0,0 +1,39 @@
+-- name: CreateInvitation :one
+INSERT INTO Invitations (id, email, site_id, organization_id, role, token_hash, invited_by, expires_at, created_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, $4, $5, $6, $7, now())
+RETURNING *;
+
+-- name: FindValidInvitationByTokenHash :one
+SELECT * FROM Invitations
+WHERE token_hash = $1
+AND expires_at > now();
+
+-- name: ListPendingInvitationsBySiteID :many
+SELECT * FROM Invitations
+WHERE site_id = $1
+AND expires_at > now()
+ORDER BY created_at DESC;
+
+-- name: ListPendingInvitationsByOrganizationID :many
+SELECT * FROM Invitations
+WHERE organization_id = $1
+AND expires_at > now()
+ORDER BY created_at DESC;
+
+-- name: DeleteInvitation :exec
+DELETE FROM Invitations
+WHERE id = $1;
+
+-- name: DeleteSiteInvitation :execrows
+DELETE FROM Invitations
+WHERE id = $1 AND site_id = $2;
+
+-- name: DeleteOrganizationInvitation :execrows
+DELETE FROM Invitations
+WHERE id = $1 AND organization_id = $2;
+
+-- name: DeletePendingInvitations :exec
+DELETE FROM Invitations
+WHERE email = $1
+AND site_id IS NOT DISTINCT FROM $2
+AND organization_id IS NOT DISTINCT FROM $3;
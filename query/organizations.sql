@@ -0,0 +1,65 @@
+-- name: CreateOrganization :one
+INSERT INTO Organizations (id, name, created_at, updated_at)
+VALUES (uuid_generate_v4(), $1, now(), now())
+RETURNING *;
+
+-- name: FindOrganizationByID :one
+SELECT * FROM Organizations WHERE id = $1;
+
+-- name: ListOrganizationsByUserID :many
+SELECT o.*, m.role FROM Organizations o
+JOIN OrganizationMembers m ON m.organization_id = o.id
+WHERE m.user_id = $1
+ORDER BY o.created_at ASC;
+
+-- name: FindDefaultOrganizationByUserID :one
+SELECT o.* FROM Organizations o
+JOIN OrganizationMembers m ON m.organization_id = o.id
+WHERE m.user_id = $1
+AND m.role = 'owner'
+ORDER BY o.created_at ASC
+LIMIT 1;
+
+-- name: UpdateOrganizationName :one
+UPDATE Organizations
+SET name = $1, updated_at = now()
+WHERE id = $2
+RETURNING *;
+
+-- name: DeleteOrganization :exec
+DELETE FROM Organizations
+WHERE id = $1;
+
+-- name: AddOrganizationMember :one
+INSERT INTO OrganizationMembers (organization_id, user_id, role, created_at)
+VALUES ($1, $2, $3, now())
+RETURNING *;
+
+-- name: AddOrganizationMemberIfAbsent :exec
+INSERT INTO OrganizationMembers (organization_id, user_id, role, created_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (organization_id, user_id) DO NOTHING;
+
+-- name: FindOrganizationMemberRole :one
+SELECT role FROM OrganizationMembers
+WHERE organization_id = $1 AND user_id = $2;
+
+-- name: ListOrganizationMembers :many
+SELECT m.user_id, u.username, u.email, m.role, m.created_at
+FROM OrganizationMembers m
+JOIN Users u ON u.id = m.user_id
+WHERE m.organization_id = $1
+ORDER BY m.created_at ASC;
+
+-- name: UpdateOrganizationMemberRole :execrows
+UPDATE OrganizationMembers
+SET role = $1
+WHERE organization_id = $2 AND user_id = $3;
+
+-- name: RemoveOrganizationMember :execrows
+DELETE FROM OrganizationMembers
+WHERE organization_id = $1 AND user_id = $2;
+
+-- name: CountOrganizationOwners :one
+SELECT COUNT(*) FROM OrganizationMembers
+WHERE organization_id = $1 AND role = 'owner';
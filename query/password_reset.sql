@@ -0,0 +1,14 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO PasswordResetTokens (id, user_id, token_hash, expires_at, created_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, now())
+RETURNING *;
+
+-- name: ConsumePasswordResetToken :one
+DELETE FROM PasswordResetTokens
+WHERE token_hash = $1
+AND expires_at > now()
+RETURNING user_id;
+
+-- name: DeletePasswordResetTokens :exec
+DELETE FROM PasswordResetTokens
+WHERE user_id = $1;
@@ -0,0 +1,53 @@
+-- name: CreateSession :one
+INSERT INTO Sessions (id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at, last_used_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, $4, $5, now(), now())
+RETURNING *;
+
+-- name: FindActiveSessionByID :one
+SELECT * FROM Sessions
+WHERE id = $1
+AND revoked_at IS NULL
+AND expires_at > now();
+
+-- name: ListActiveSessionsByUserID :many
+SELECT * FROM Sessions
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND expires_at > now()
+ORDER BY last_used_at DESC;
+
+-- name: RotateSessionRefreshToken :one
+UPDATE Sessions
+SET previous_refresh_token_hash = refresh_token_hash,
+    refresh_token_hash = sqlc.arg(new_refresh_token_hash),
+    expires_at = sqlc.arg(expires_at),
+    last_used_at = now()
+WHERE refresh_token_hash = sqlc.arg(refresh_token_hash)
+AND revoked_at IS NULL
+AND expires_at > now()
+RETURNING *;
+
+-- name: RevokeSessionByRefreshTokenHash :exec
+UPDATE Sessions
+SET revoked_at = now()
+WHERE refresh_token_hash = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeSessionByPreviousRefreshTokenHash :exec
+UPDATE Sessions
+SET revoked_at = now()
+WHERE previous_refresh_token_hash = sqlc.arg(refresh_token_hash)::VARCHAR
+AND revoked_at IS NULL;
+
+-- name: RevokeUserSession :execrows
+UPDATE Sessions
+SET revoked_at = now()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE Sessions
+SET revoked_at = now()
+WHERE user_id = $1
+AND revoked_at IS NULL;
@@ -0,0 +1,18 @@
+-- name: CreateSharedLink :one
+INSERT INTO SharedLinks (id, site_id, slug, passHash, expires_at, created_by, created_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, $4, $5, now())
+RETURNING *;
+
+-- name: FindActiveSharedLinkBySlug :one
+SELECT * FROM SharedLinks
+WHERE slug = $1
+AND (expires_at IS NULL OR expires_at > now());
+
+-- name: ListSharedLinksBySiteID :many
+SELECT * FROM SharedLinks
+WHERE site_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteSharedLink :execrows
+DELETE FROM SharedLinks
+WHERE id = $1 AND site_id = $2;
@@ -0,0 +1,32 @@
+-- name: FindSiteDomain :one
+SELECT * FROM SiteDomains
+WHERE domain = $1;
+
+-- name: ListSiteDomains :many
+SELECT * FROM SiteDomains
+WHERE site_id = $1
+ORDER BY is_primary DESC, created_at;
+
+-- name: AddSiteAlias :one
+INSERT INTO SiteDomains (site_id, domain, is_primary, created_at)
+VALUES ($1, $2, FALSE, now())
+RETURNING *;
+
+-- name: KeepSiteAlias :exec
+INSERT INTO SiteDomains (site_id, domain, is_primary, created_at)
+VALUES ($1, $2, FALSE, now())
+ON CONFLICT DO NOTHING;
+
+-- name: DemoteSitePrimaryDomain :exec
+UPDATE SiteDomains
+SET is_primary = FALSE
+WHERE site_id = $1 AND is_primary;
+
+-- name: SetSitePrimaryDomain :exec
+INSERT INTO SiteDomains (site_id, domain, is_primary, created_at)
+VALUES ($1, $2, TRUE, now())
+ON CONFLICT (site_id, domain) DO UPDATE SET is_primary = TRUE;
+
+-- name: DeleteSiteAlias :execrows
+DELETE FROM SiteDomains
+WHERE site_id = $1 AND domain = $2 AND NOT is_primary;
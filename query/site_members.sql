@@ -0,0 +1,15 @@
+-- name: AddSiteMember :exec
+INSERT INTO SiteMembers (site_id, user_id, role, created_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (site_id, user_id) DO NOTHING;
+
+-- name: ListSiteMembers :many
+SELECT m.user_id, u.username, u.email, m.role, m.created_at
+FROM SiteMembers m
+JOIN Users u ON u.id = m.user_id
+WHERE m.site_id = $1
+ORDER BY m.created_at ASC;
+
+-- name: RemoveSiteMember :execrows
+DELETE FROM SiteMembers
+WHERE site_id = $1 AND user_id = $2;
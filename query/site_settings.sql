@@ -0,0 +1,13 @@
+-- name: GetSiteSettings :one
+SELECT * FROM SiteSettings WHERE site_id = $1;
+
+-- name: UpsertSiteSettings :one
+INSERT INTO SiteSettings (site_id, session_timeout_minutes, timezone, excluded_ips, excluded_paths, updated_at)
+VALUES ($1, $2, $3, $4, $5, now())
+ON CONFLICT (site_id) DO UPDATE
+SET session_timeout_minutes = EXCLUDED.session_timeout_minutes,
+    timezone = EXCLUDED.timezone,
+    excluded_ips = EXCLUDED.excluded_ips,
+    excluded_paths = EXCLUDED.excluded_paths,
+    updated_at = now()
+RETURNING *;
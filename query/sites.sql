@@ -2,19 +2,37 @@
 SELECT * FROM sites WHERE id = $1;
 
 -- name: CreateSite :one
-INSERT INTO sites (id, user_id, site_url, created_at, updated_at)
-VALUES (uuid_generate_v4(), $1, $2, now(), now())
+INSERT INTO sites (id, user_id, organization_id, site_url, created_at, updated_at)
+VALUES (uuid_generate_v4(), $1, $2, $3, now(), now())
 RETURNING *;
 
--- name: FindSiteByUserIDAndURL :one
+-- name: FindSiteByOrganizationIDAndURL :one
 SELECT * FROM sites
-WHERE user_id = $1 AND site_url = $2;
+WHERE organization_id = $1 AND site_url = $2;
 
 -- name: ListSitesByUserID :many
 SELECT * FROM sites
-WHERE user_id = $1
+WHERE organization_id IN (SELECT organization_id FROM OrganizationMembers WHERE OrganizationMembers.user_id = $1)
+OR id IN (SELECT site_id FROM SiteMembers WHERE SiteMembers.user_id = $1)
 ORDER BY created_at DESC;
 
+-- name: ListSitesByOrganizationID :many
+SELECT * FROM sites
+WHERE organization_id = $1
+ORDER BY created_at DESC;
+
+-- name: FindUserSiteRole :one
+SELECT role FROM (
+  SELECT m.role FROM sites
+  JOIN OrganizationMembers m ON m.organization_id = sites.organization_id
+  WHERE sites.id = sqlc.arg(site_id) AND m.user_id = sqlc.arg(user_id)
+  UNION ALL
+  SELECT SiteMembers.role FROM SiteMembers
+  WHERE SiteMembers.site_id = sqlc.arg(site_id) AND SiteMembers.user_id = sqlc.arg(user_id)
+) AS roles
+ORDER BY CASE role WHEN 'owner' THEN 3 WHEN 'admin' THEN 2 ELSE 1 END DESC
+LIMIT 1;
+
 -- name: UpdateSiteURL :one
 UPDATE sites
 SET site_url = $1, updated_at = now()
@@ -23,8 +41,8 @@ RETURNING *;
 
 -- name: DeleteSite :exec
 DELETE FROM sites
-WHERE id = $1 AND user_id = $2;
+WHERE id = $1;
 
 -- name: GetSiteCount :one
 SELECT COUNT(*) FROM sites
-WHERE user_id = $1;
\ No newline at end of file
+WHERE user_id = $1;
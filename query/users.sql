@@ -13,7 +13,7 @@ VALUES (uuid_generate_v4(), $1, $2, $3, now(), now())
 RETURNING *;
 
 -- name: UpdateUserPassword :exec
-UPDATE users SET passHash = $1 WHERE id = $2;
+UPDATE users SET passHash = $1, updated_at = now() WHERE id = $2;
 
 -- name: UpdateEmailVerificationStatus :exec
 UPDATE users SET email_verified = $1 WHERE id = $2;